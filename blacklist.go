@@ -0,0 +1,53 @@
+// 黑名单管理
+package weixin_api
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// 批量拉黑或取消拉黑时每次最多的用户数
+const MaxBatchBlacklist = 20
+
+type reqGetBlacklist struct {
+	BeginOpenId string `json:"begin_openid"`
+}
+
+// GetBlacklist 获取公众号的黑名单列表，一次最多拉取10000个，beginOpenId为空时从头开始拉取
+func (e *Engine) GetBlacklist(ctx context.Context, beginOpenId string) (*OpenIdList, error) {
+	// https://api.weixin.qq.com/cgi-bin/tags/members/getblacklist?access_token=ACCESS_TOKEN
+	info, err := postJSON[OpenIdList](ctx, e, "/cgi-bin/tags/members/getblacklist", &reqGetBlacklist{BeginOpenId: beginOpenId})
+	if err != nil {
+		return nil, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+// Blacklist 遍历黑名单，cursor为空时从头开始，否则从cursor之后继续
+func (e *Engine) Blacklist(cursor string) *OpenIdIterator {
+	return newOpenIdIterator(cursor, e.GetBlacklist)
+}
+
+type reqOpenIdList struct {
+	OpenIdList []string `json:"openid_list"`
+}
+
+// BatchBlacklist 拉黑用户，按每批20个拆分，部分批次失败时返回*BatchError
+func (e *Engine) BatchBlacklist(ctx context.Context, openIds []string) error {
+	// https://api.weixin.qq.com/cgi-bin/tags/members/batchblacklist?access_token=ACCESS_TOKEN
+	return batchOpenIds(ctx, openIds, MaxBatchBlacklist, func(ids []string) error {
+		return postJSONCheck(ctx, e, "/cgi-bin/tags/members/batchblacklist", &reqOpenIdList{OpenIdList: ids})
+	})
+}
+
+// BatchUnblacklist 取消拉黑用户，按每批20个拆分，部分批次失败时返回*BatchError
+func (e *Engine) BatchUnblacklist(ctx context.Context, openIds []string) error {
+	// https://api.weixin.qq.com/cgi-bin/tags/members/batchunblacklist?access_token=ACCESS_TOKEN
+	return batchOpenIds(ctx, openIds, MaxBatchBlacklist, func(ids []string) error {
+		return postJSONCheck(ctx, e, "/cgi-bin/tags/members/batchunblacklist", &reqOpenIdList{OpenIdList: ids})
+	})
+}
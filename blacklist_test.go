@@ -0,0 +1,113 @@
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchBlacklist(t *testing.T) {
+	var batches [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cgi-bin/tags/members/batchblacklist", r.URL.Path)
+		var req reqOpenIdList
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		batches = append(batches, req.OpenIdList)
+		if len(batches) == 2 {
+			w.Write([]byte(`{"errcode":40003,"errmsg":"invalid openid"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	var openIds []string
+	for i := 0; i < 45; i++ {
+		openIds = append(openIds, strconv.Itoa(i))
+	}
+	err := e.BatchBlacklist(context.Background(), openIds)
+	if assert.Len(t, batches, 3) {
+		assert.Len(t, batches[0], MaxBatchBlacklist)
+		assert.Len(t, batches[1], MaxBatchBlacklist)
+		assert.Len(t, batches[2], 5)
+	}
+
+	var batchErr *BatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.Equal(t, openIds[20:40], batchErr.OpenIds)
+	}
+	assert.ErrorIs(t, err, ErrInvalidOpenId)
+}
+
+func TestBlacklistIterator(t *testing.T) {
+	pages := map[string][]string{
+		"":  {"a", "b"},
+		"b": {"c"},
+		"c": nil,
+	}
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cgi-bin/tags/members/getblacklist", r.URL.Path)
+		var req reqGetBlacklist
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		cursors = append(cursors, req.BeginOpenId)
+		var list OpenIdList
+		list.Total = 3
+		list.Data.OpenId = pages[req.BeginOpenId]
+		list.Count = int32(len(list.Data.OpenId))
+		if list.Count > 0 {
+			list.NextOpenId = list.Data.OpenId[list.Count-1]
+		}
+		json.NewEncoder(w).Encode(&list)
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	var openIds []string
+	it := e.Blacklist("")
+	for it.Next(context.Background()) {
+		openIds = append(openIds, it.OpenIds()...)
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"a", "b", "c"}, openIds)
+	assert.Equal(t, []string{"", "b", "c"}, cursors)
+	assert.Equal(t, int32(3), it.Total())
+}
+
+func TestBatchBlacklistCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var batches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		batches++
+		if batches == 1 {
+			w.Write([]byte(`{"errcode":40003,"errmsg":"invalid openid"}`))
+			return
+		}
+		// 第二批请求还没返回时取消，剩下的批次不再发送
+		cancel()
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	var openIds []string
+	for i := 0; i < 45; i++ {
+		openIds = append(openIds, strconv.Itoa(i))
+	}
+	err := e.BatchUnblacklist(ctx, openIds)
+	assert.Equal(t, 2, batches)
+	assert.ErrorIs(t, err, context.Canceled)
+	var batchErr *BatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		// 第一批失败，第二批被取消，第三批没有处理
+		assert.Equal(t, openIds, batchErr.OpenIds)
+		assert.Contains(t, batchErr.Error(), "invalid openid")
+	}
+}
@@ -0,0 +1,203 @@
+// 个性化菜单
+package weixin_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// MatchRule中的性别
+const (
+	SexMale   = "1"
+	SexFemale = "2"
+)
+
+// MatchRule中的客户端版本
+const (
+	ClientPlatformIOS     = "1"
+	ClientPlatformAndroid = "2"
+	ClientPlatformOthers  = "3"
+)
+
+// MatchRule 个性化菜单的匹配规则，至少要有一个字段不为空
+type MatchRule struct {
+	TagId              string `json:"tag_id,omitempty" yaml:"tag_id,omitempty"`                             // 用户标签的id
+	Sex                string `json:"sex,omitempty" yaml:"sex,omitempty"`                                   // 性别：男（1）女（2）
+	Country            string `json:"country,omitempty" yaml:"country,omitempty"`                           // 国家信息，是用户在微信中设置的地区
+	Province           string `json:"province,omitempty" yaml:"province,omitempty"`                         // 省份信息
+	City               string `json:"city,omitempty" yaml:"city,omitempty"`                                 // 城市信息
+	ClientPlatformType string `json:"client_platform_type,omitempty" yaml:"client_platform_type,omitempty"` // 客户端版本：IOS(1), Android(2), Others(3)
+	Language           string `json:"language,omitempty" yaml:"language,omitempty"`                         // 语言信息，是用户在微信中设置的语言
+}
+
+// UnmarshalJSON 查询菜单时微信返回的匹配规则中部分字段是数字，统一转成字符串，
+// 旧版本的group_id转成TagId
+func (r *MatchRule) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	// tag_id在group_id之后，两者都有时以tag_id为准
+	fields := []struct {
+		name string
+		dst  *string
+	}{
+		{"group_id", &r.TagId},
+		{"tag_id", &r.TagId},
+		{"sex", &r.Sex},
+		{"country", &r.Country},
+		{"province", &r.Province},
+		{"city", &r.City},
+		{"client_platform_type", &r.ClientPlatformType},
+		{"language", &r.Language},
+	}
+	for _, f := range fields {
+		v, ok := raw[f.name]
+		if !ok || bytes.Equal(v, []byte("null")) {
+			continue
+		}
+		if v[0] != '"' {
+			*f.dst = string(v)
+			continue
+		}
+		var str string
+		if err := json.Unmarshal(v, &str); err != nil {
+			return err
+		}
+		if str != "" {
+			*f.dst = str
+		}
+	}
+	return nil
+}
+
+// Validate 检查匹配规则，至少要有一个字段不为空，设置了province时必须设置country，设置了city时必须设置province
+func (r *MatchRule) Validate() error {
+	if r == nil || *r == (MatchRule{}) {
+		return &ErrInvalidMenu{Path: "matchrule", Reason: "个性化菜单的匹配规则不能为空"}
+	}
+	if r.Province != "" && r.Country == "" {
+		return &ErrInvalidMenu{Path: "matchrule", Reason: "设置province时必须设置country"}
+	}
+	if r.City != "" && r.Province == "" {
+		return &ErrInvalidMenu{Path: "matchrule", Reason: "设置city时必须设置province"}
+	}
+	return nil
+}
+
+// MenuUserProfile 用来在本地预览个性化菜单匹配结果的用户信息
+type MenuUserProfile struct {
+	TagIds             []int32 // 用户身上的标签
+	Sex                string  // 性别
+	Country            string  // 国家
+	Province           string  // 省份
+	City               string  // 城市
+	ClientPlatformType string  // 客户端版本
+	Language           string  // 语言
+}
+
+// Match 用户是否符合匹配规则，规则中所有不为空的字段都相符才算匹配
+func (r *MatchRule) Match(p *MenuUserProfile) bool {
+	if r.TagId != "" {
+		tagId, err := strconv.ParseInt(r.TagId, 10, 32)
+		if err != nil {
+			return false
+		}
+		found := false
+		for _, id := range p.TagIds {
+			if id == int32(tagId) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return matchRuleField(r.Sex, p.Sex) &&
+		matchRuleField(r.Country, p.Country) &&
+		matchRuleField(r.Province, p.Province) &&
+		matchRuleField(r.City, p.City) &&
+		matchRuleField(r.ClientPlatformType, p.ClientPlatformType) &&
+		matchRuleField(r.Language, p.Language)
+}
+
+func matchRuleField(rule, value string) bool {
+	return rule == "" || rule == value
+}
+
+// MatchMenu 按微信的规则在本地预览用户会看到的菜单：个性化菜单按发布顺序由新到旧逐一匹配，
+// 都不匹配时返回默认菜单。ConditionalMenu需要按发布顺序排列，和GetMenu返回的顺序一致。
+func (m *MenuInfo) MatchMenu(p *MenuUserProfile) *Menu {
+	for i := len(m.ConditionalMenu) - 1; i >= 0; i-- {
+		menu := m.ConditionalMenu[i]
+		if menu.MatchRule != nil && menu.MatchRule.Match(p) {
+			return menu
+		}
+	}
+	return m.Menu
+}
+
+type respAddConditionalMenu struct {
+	ErrorMsg
+	MenuId json.Number `json:"menuid"`
+}
+
+// AddConditionalMenu 创建个性化菜单，返回menuid。创建前需要先有默认菜单。
+func (e *Engine) AddConditionalMenu(ctx context.Context, menu *Menu) (int64, error) {
+	if err := menu.Validate(); err != nil {
+		return 0, err
+	}
+	if err := menu.MatchRule.Validate(); err != nil {
+		return 0, err
+	}
+	// https://api.weixin.qq.com/cgi-bin/menu/addconditional?access_token=ACCESS_TOKEN
+	info, err := postJSON[respAddConditionalMenu](ctx, e, "/cgi-bin/menu/addconditional", menu)
+	if err != nil {
+		return 0, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return 0, errors.WithStack(&info.ErrorMsg)
+	}
+	menuId, err := info.MenuId.Int64()
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid menuid")
+	}
+	return menuId, nil
+}
+
+type reqDelConditionalMenu struct {
+	MenuId string `json:"menuid"`
+}
+
+// DeleteConditionalMenu 删除个性化菜单
+func (e *Engine) DeleteConditionalMenu(ctx context.Context, menuId int64) error {
+	// https://api.weixin.qq.com/cgi-bin/menu/delconditional?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/menu/delconditional", &reqDelConditionalMenu{MenuId: strconv.FormatInt(menuId, 10)})
+}
+
+type reqTryMatchMenu struct {
+	UserId string `json:"user_id"`
+}
+
+type respTryMatchMenu struct {
+	ErrorMsg
+	Menu
+}
+
+// TryMatchMenu 测试个性化菜单匹配结果，userId可以是粉丝的openid，也可以是粉丝的微信号
+func (e *Engine) TryMatchMenu(ctx context.Context, userId string) (*Menu, error) {
+	// https://api.weixin.qq.com/cgi-bin/menu/trymatch?access_token=ACCESS_TOKEN
+	info, err := postJSON[respTryMatchMenu](ctx, e, "/cgi-bin/menu/trymatch", &reqTryMatchMenu{UserId: userId})
+	if err != nil {
+		return nil, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return &info.Menu, nil
+}
@@ -0,0 +1,58 @@
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchMenu(t *testing.T) {
+	info := &MenuInfo{
+		Menu: &Menu{Button: []*Button{ClickButton("default", "default")}},
+		ConditionalMenu: []*Menu{
+			{Button: []*Button{ClickButton("ios", "ios")}, MatchRule: &MatchRule{ClientPlatformType: ClientPlatformIOS}},
+			{Button: []*Button{ClickButton("vip", "vip")}, MatchRule: &MatchRule{TagId: "100", Language: LangZhCN}},
+		},
+	}
+
+	assert.Equal(t, info.Menu, info.MatchMenu(&MenuUserProfile{ClientPlatformType: ClientPlatformAndroid}))
+	assert.Equal(t, info.ConditionalMenu[0], info.MatchMenu(&MenuUserProfile{ClientPlatformType: ClientPlatformIOS}))
+	assert.Equal(t, info.ConditionalMenu[0], info.MatchMenu(&MenuUserProfile{TagIds: []int32{100}, Language: "en", ClientPlatformType: ClientPlatformIOS}))
+	// 新发布的个性化菜单优先匹配
+	assert.Equal(t, info.ConditionalMenu[1], info.MatchMenu(&MenuUserProfile{TagIds: []int32{2, 100}, Language: LangZhCN, ClientPlatformType: ClientPlatformIOS}))
+}
+
+func TestMatchRuleValidate(t *testing.T) {
+	assert.Error(t, (*MatchRule)(nil).Validate())
+	assert.Error(t, (&MatchRule{}).Validate())
+	assert.Error(t, (&MatchRule{Province: "广东"}).Validate())
+	assert.Error(t, (&MatchRule{Country: "中国", City: "广州"}).Validate())
+	assert.Nil(t, (&MatchRule{Country: "中国", Province: "广东", City: "广州"}).Validate())
+}
+
+func TestAddConditionalMenu(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, map[string]interface{}{"tag_id": "2", "client_platform_type": "2"}, req["matchrule"])
+		w.Write([]byte(`{"menuid":"208379533"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	menuId, err := e.AddConditionalMenu(context.Background(), &Menu{
+		Button:    []*Button{ClickButton("今日歌曲", "V1001_TODAY_MUSIC")},
+		MatchRule: &MatchRule{TagId: "2", ClientPlatformType: ClientPlatformAndroid},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(208379533), menuId)
+
+	_, err = e.AddConditionalMenu(context.Background(), &Menu{Button: []*Button{ClickButton("今日歌曲", "V1001_TODAY_MUSIC")}})
+	var menuErr *ErrInvalidMenu
+	assert.ErrorAs(t, err, &menuErr)
+}
@@ -0,0 +1,231 @@
+package weixin_api
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrAESKeyNotSet         = errors.New("未设置EncodingAESKey")
+	ErrInvalidAESKey        = errors.New("EncodingAESKey无效")
+	ErrInvalidMsgSignature  = errors.New("msg_signature校验失败")
+	ErrInvalidEncryptedData = errors.New("密文格式错误")
+	ErrAppIdMismatch        = errors.New("消息的AppId不匹配")
+)
+
+// 安全模式下消息体的填充长度
+const aesBlockSize = 32
+
+// DecodeAESKey 解析公众号后台设置的43位EncodingAESKey
+func DecodeAESKey(encodingAESKey string) ([]byte, error) {
+	if len(encodingAESKey) != 43 {
+		return nil, ErrInvalidAESKey
+	}
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidAESKey, err.Error())
+	}
+	return key, nil
+}
+
+// 计算安全模式下的消息签名msg_signature
+func MsgSignature(tok, timestamp, nonce, encrypt string) string {
+	strs := []string{tok, timestamp, nonce, encrypt}
+	sort.Strings(strs)
+
+	tmpStr := strings.Join(strs, "")
+	return fmt.Sprintf("%x", sha1.Sum([]byte(tmpStr)))
+}
+
+// 验证安全模式下的消息签名是否合法
+func ValidateMsgSignature(tok, timestamp, nonce, encrypt, msgSignature string) bool {
+	return MsgSignature(tok, timestamp, nonce, encrypt) == msgSignature
+}
+
+// DecryptMessage 解密消息体，返回明文消息以及消息所属的AppId
+func DecryptMessage(key []byte, encrypt string) ([]byte, string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return nil, "", errors.Wrap(ErrInvalidEncryptedData, err.Error())
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, "", errors.Wrap(ErrInvalidAESKey, err.Error())
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, "", ErrInvalidEncryptedData
+	}
+
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, key[:aes.BlockSize]).CryptBlocks(plain, ciphertext)
+
+	// 去掉PKCS#7填充
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > aesBlockSize || pad > len(plain) {
+		return nil, "", ErrInvalidEncryptedData
+	}
+	plain = plain[:len(plain)-pad]
+
+	// 16字节随机串 + 4字节消息长度 + 消息 + AppId
+	if len(plain) < 20 {
+		return nil, "", ErrInvalidEncryptedData
+	}
+	msgLen := int(binary.BigEndian.Uint32(plain[16:20]))
+	if msgLen > len(plain)-20 {
+		return nil, "", ErrInvalidEncryptedData
+	}
+	msg := plain[20 : 20+msgLen]
+	appId := string(plain[20+msgLen:])
+	return msg, appId, nil
+}
+
+// EncryptMessage 加密消息体，返回base64编码后的密文
+func EncryptMessage(key []byte, appId string, msg []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", errors.Wrap(ErrInvalidAESKey, err.Error())
+	}
+
+	var buf bytes.Buffer
+	random := make([]byte, 16)
+	if _, err = rand.Read(random); err != nil {
+		return "", errors.Wrap(err, "rand.Read")
+	}
+	buf.Write(random)
+	var msgLen [4]byte
+	binary.BigEndian.PutUint32(msgLen[:], uint32(len(msg)))
+	buf.Write(msgLen[:])
+	buf.Write(msg)
+	buf.WriteString(appId)
+
+	// PKCS#7填充
+	pad := aesBlockSize - buf.Len()%aesBlockSize
+	buf.Write(bytes.Repeat([]byte{byte(pad)}, pad))
+
+	plain := buf.Bytes()
+	ciphertext := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, key[:aes.BlockSize]).CryptBlocks(ciphertext, plain)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// 安全模式或兼容模式下推送的消息，兼容模式下同时带有明文字段
+type encryptedMessage struct {
+	ToUserName string
+	Encrypt    string
+}
+
+type encryptedReply struct {
+	XMLName      xml.Name `xml:"xml"`
+	Encrypt      cdataValue
+	MsgSignature cdataValue
+	TimeStamp    string
+	Nonce        cdataValue
+}
+
+func (e *Engine) getAESKey() ([]byte, error) {
+	if e.aesKeyErr != nil {
+		return nil, e.aesKeyErr
+	}
+	if e.aesKey == nil {
+		return nil, ErrAESKeyNotSet
+	}
+	return e.aesKey, nil
+}
+
+// DecryptMessage 校验msg_signature并解密消息，消息中没有Encrypt字段时原样返回
+func (e *Engine) DecryptMessage(timestamp, nonce, msgSignature string, data []byte) ([]byte, bool, error) {
+	m, err := DecodeRawMessage[encryptedMessage](data)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "DecodeXML")
+	}
+	if m.Encrypt == "" {
+		// 明文模式，或兼容模式下只有明文
+		return data, false, nil
+	}
+
+	key, err := e.getAESKey()
+	if err != nil {
+		return nil, true, err
+	}
+	if !ValidateMsgSignature(e.appToken, timestamp, nonce, m.Encrypt, msgSignature) {
+		return nil, true, ErrInvalidMsgSignature
+	}
+	msg, appId, err := DecryptMessage(key, m.Encrypt)
+	if err != nil {
+		return nil, true, err
+	}
+	if appId != e.appId {
+		return nil, true, ErrAppIdMismatch
+	}
+	return msg, true, nil
+}
+
+// EncryptReply 加密被动回复消息并签名
+func (e *Engine) EncryptReply(reply []byte) ([]byte, error) {
+	key, err := e.getAESKey()
+	if err != nil {
+		return nil, err
+	}
+	encrypt, err := EncryptMessage(key, e.appId, reply)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce, err := randomString(10)
+	if err != nil {
+		return nil, err
+	}
+	r := encryptedReply{
+		Encrypt:      cdataValue{Value: encrypt},
+		MsgSignature: cdataValue{Value: MsgSignature(e.appToken, timestamp, nonce, encrypt)},
+		TimeStamp:    timestamp,
+		Nonce:        cdataValue{Value: nonce},
+	}
+	data, err := xml.Marshal(&r)
+	if err != nil {
+		return nil, errors.Wrap(err, "xml.Marshal")
+	}
+	return data, nil
+}
+
+// HandleEncryptedMessage 处理安全模式或兼容模式下推送的消息，返回加密后的被动回复。
+// 消息没有加密时等同于HandleMessage。
+func (e *Engine) HandleEncryptedMessage(c context.Context, timestamp, nonce, msgSignature string, data []byte) ([]byte, error) {
+	msg, encrypted, err := e.DecryptMessage(timestamp, nonce, msgSignature, data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "DecryptMessage")
+	}
+	reply, err := e.HandleMessage(c, msg)
+	if err != nil || reply == nil || !encrypted {
+		return reply, err
+	}
+	return e.EncryptReply(reply)
+}
+
+const letters = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "rand.Read")
+	}
+	for i := range b {
+		b[i] = letters[int(b[i])%len(letters)]
+	}
+	return string(b), nil
+}
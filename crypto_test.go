@@ -0,0 +1,65 @@
+package weixin_api
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAESKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+
+func TestEncryptDecryptMessage(t *testing.T) {
+	key, err := DecodeAESKey(testAESKey)
+	assert.Nil(t, err)
+	assert.Len(t, key, 32)
+
+	encrypt, err := EncryptMessage(key, "wx123", []byte("<xml>hello</xml>"))
+	assert.Nil(t, err)
+
+	msg, appId, err := DecryptMessage(key, encrypt)
+	assert.Nil(t, err)
+	assert.Equal(t, "<xml>hello</xml>", string(msg))
+	assert.Equal(t, "wx123", appId)
+
+	_, err = DecodeAESKey("short")
+	assert.ErrorIs(t, err, ErrInvalidAESKey)
+}
+
+func TestHandleEncryptedMessage(t *testing.T) {
+	e := New(&WeiXinApiConfig{AppId: "wx123", AppToken: "token", EncodingAESKey: testAESKey})
+	e.RegTextMessageHandler(func(m *TextMessage) (Reply, error) {
+		return &TextReply{Content: m.Content}, nil
+	})
+
+	plain := `<xml><ToUserName><![CDATA[gh_1]]></ToUserName><FromUserName><![CDATA[openid]]></FromUserName><CreateTime>1</CreateTime><MsgType><![CDATA[text]]></MsgType><Content><![CDATA[hi]]></Content><MsgId>1</MsgId></xml>`
+	encrypt, err := EncryptMessage(e.aesKey, "wx123", []byte(plain))
+	assert.Nil(t, err)
+	body := []byte("<xml><ToUserName><![CDATA[gh_1]]></ToUserName><Encrypt><![CDATA[" + encrypt + "]]></Encrypt></xml>")
+
+	_, err = e.HandleEncryptedMessage(context.Background(), "1409304348", "nonce", "bad", body)
+	assert.ErrorIs(t, err, ErrInvalidMsgSignature)
+
+	sig := MsgSignature("token", "1409304348", "nonce", encrypt)
+	data, err := e.HandleEncryptedMessage(context.Background(), "1409304348", "nonce", sig, body)
+	assert.Nil(t, err)
+
+	r, err := DecodeRawMessage[struct {
+		Encrypt      string
+		MsgSignature string
+		TimeStamp    string
+		Nonce        string
+	}](data)
+	assert.Nil(t, err)
+	assert.True(t, ValidateMsgSignature("token", r.TimeStamp, r.Nonce, r.Encrypt, r.MsgSignature))
+	reply, appId, err := DecryptMessage(e.aesKey, r.Encrypt)
+	assert.Nil(t, err)
+	assert.Equal(t, "wx123", appId)
+	assert.True(t, strings.Contains(string(reply), "<Content><![CDATA[hi]]></Content>"))
+
+	// 兼容模式下没有加密字段的消息按明文处理
+	data, err = e.HandleEncryptedMessage(context.Background(), "1409304348", "nonce", "", []byte(plain))
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "<Content><![CDATA[hi]]></Content>")
+}
@@ -0,0 +1,107 @@
+// 推送消息去重
+package weixin_api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// 去重记录默认的保存时间，微信最多重试三次，每次间隔5秒
+const DefaultDedupTTL = time.Minute
+
+// 重复推送时等待第一次推送处理完成的轮询间隔
+const dedupPollInterval = 100 * time.Millisecond
+
+// 重复推送时等待第一次推送处理完成的最长时间，需要在微信5秒的超时之前回复
+var dedupWaitTimeout = 4 * time.Second
+
+// ErrDedupPending 重复推送时第一次推送在等待时间内还没处理完。
+// 这时不能回复success，否则微信认为消息已经送达，第一次推送的回复就丢了。
+var ErrDedupPending = errors.New("第一次推送的消息还在处理中")
+
+// DedupEntry 已经收到过的消息
+type DedupEntry struct {
+	Done  bool   // 第一次推送是否已经处理完成
+	Reply []byte // 处理完成时编码好的被动回复，没有回复时为空
+}
+
+// IDedupStore 保存收到过的消息和回复，用来识别微信的重试推送
+type IDedupStore interface {
+	// Begin 第一次收到key时记录下来并返回nil，表示由调用方处理；key已存在时返回已保存的记录
+	Begin(ctx context.Context, key string, ttl time.Duration) (*DedupEntry, error)
+	// Finish 保存处理完成后的回复
+	Finish(ctx context.Context, key string, reply []byte, ttl time.Duration) error
+	// Abort 处理失败时删除key，微信重试时重新处理
+	Abort(ctx context.Context, key string) error
+}
+
+type dedupFields struct {
+	FromUserName string
+	CreateTime   int64
+	MsgId        int64
+	Event        string
+}
+
+// DedupKey 消息用MsgId去重，事件没有MsgId，用FromUserName+CreateTime+Event去重
+func DedupKey(data []byte) (string, error) {
+	m, err := DecodeRawMessage[dedupFields](data)
+	if err != nil {
+		return "", err
+	}
+	if m.MsgId != 0 {
+		return fmt.Sprintf("msg:%d", m.MsgId), nil
+	}
+	return fmt.Sprintf("event:%s:%d:%s", m.FromUserName, m.CreateTime, m.Event), nil
+}
+
+// handleMessageOnce 重复推送的消息不再处理，直接返回第一次推送的回复。
+// 第一次推送还在处理时等待它完成，等待超时返回ErrDedupPending；去重存储出错时照常处理消息。
+func (e *Engine) handleMessageOnce(c context.Context, data []byte) ([]byte, error) {
+	key, err := DedupKey(data)
+	if err != nil {
+		return e.handleMessage(c, data)
+	}
+
+	deadline := time.Now().Add(dedupWaitTimeout)
+	for {
+		entry, err := e.dedup.Begin(c, key, e.dedupTTL)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("[HandleMessage]消息去重失败")
+			return e.handleMessage(c, data)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Done {
+			if len(entry.Reply) == 0 {
+				return nil, nil
+			}
+			return entry.Reply, nil
+		}
+		if time.Now().After(deadline) {
+			// 第一次推送还没处理完，返回错误让微信稍后再重试，重试时可以拿到第一次推送的回复
+			return nil, ErrDedupPending
+		}
+		select {
+		case <-time.After(dedupPollInterval):
+		case <-c.Done():
+			return nil, c.Err()
+		}
+	}
+
+	reply, err := e.handleMessage(c, data)
+	if err != nil {
+		if abortErr := e.dedup.Abort(c, key); abortErr != nil {
+			log.Error().Err(abortErr).Str("key", key).Msg("[HandleMessage]删除去重记录失败")
+		}
+		return nil, err
+	}
+	if err := e.dedup.Finish(c, key, reply, e.dedupTTL); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("[HandleMessage]保存去重记录失败")
+	}
+	return reply, nil
+}
@@ -0,0 +1,173 @@
+package weixin_api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDedupStore struct {
+	mu      sync.Mutex
+	entries map[string]*DedupEntry
+}
+
+func (s *testDedupStore) Begin(_ context.Context, key string, _ time.Duration) (*DedupEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[key]; ok {
+		copied := *entry
+		return &copied, nil
+	}
+	s.entries[key] = &DedupEntry{}
+	return nil, nil
+}
+
+func (s *testDedupStore) Finish(_ context.Context, key string, reply []byte, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &DedupEntry{Done: true, Reply: reply}
+	return nil
+}
+
+func (s *testDedupStore) Abort(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func TestDedupKey(t *testing.T) {
+	key, err := DedupKey([]byte(`<xml><FromUserName><![CDATA[fromUser]]></FromUserName><CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[text]]></MsgType><MsgId>1234567890123456</MsgId></xml>`))
+	assert.Nil(t, err)
+	assert.Equal(t, "msg:1234567890123456", key)
+
+	key, err = DedupKey([]byte(`<xml><FromUserName><![CDATA[fromUser]]></FromUserName><CreateTime>123456789</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType><Event><![CDATA[subscribe]]></Event></xml>`))
+	assert.Nil(t, err)
+	assert.Equal(t, "event:fromUser:123456789:subscribe", key)
+}
+
+const testDedupText = `<xml><ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[text]]></MsgType>
+	<Content><![CDATA[hi]]></Content>
+	<MsgId>1234567890123456</MsgId>
+	</xml>`
+
+func TestHandleMessageDedup(t *testing.T) {
+	var calls int
+	e := New(&WeiXinApiConfig{
+		DedupStore: &testDedupStore{entries: map[string]*DedupEntry{}},
+		HandleTextMessage: func(m *TextMessage) (Reply, error) {
+			calls++
+			return &TextReply{Content: "hello"}, nil
+		},
+	})
+
+	first, err := e.HandleMessage(context.Background(), []byte(testDedupText))
+	assert.Nil(t, err)
+	retry, err := e.HandleMessage(context.Background(), []byte(testDedupText))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, first, retry)
+	assert.Contains(t, string(retry), "<Content><![CDATA[hello]]></Content>")
+}
+
+func TestHandleMessageDedupInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls int
+	e := New(&WeiXinApiConfig{
+		DedupStore: &testDedupStore{entries: map[string]*DedupEntry{}},
+		HandleTextMessage: func(m *TextMessage) (Reply, error) {
+			calls++
+			close(started)
+			<-release
+			return &TextReply{Content: "slow"}, nil
+		},
+	})
+
+	var first []byte
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		first, _ = e.HandleMessage(context.Background(), []byte(testDedupText))
+	}()
+	<-started
+	time.AfterFunc(2*dedupPollInterval, func() { close(release) })
+
+	// 第一次推送处理完成前收到的重试等待并得到同样的回复
+	retry, err := e.HandleMessage(context.Background(), []byte(testDedupText))
+	<-done
+	assert.Nil(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, first, retry)
+	assert.Contains(t, string(retry), "slow")
+}
+
+func TestHandleMessageDedupError(t *testing.T) {
+	var calls int
+	e := New(&WeiXinApiConfig{
+		DedupStore: &testDedupStore{entries: map[string]*DedupEntry{}},
+		HandleTextMessage: func(m *TextMessage) (Reply, error) {
+			calls++
+			if calls == 1 {
+				return nil, errors.New("failed")
+			}
+			return nil, nil
+		},
+	})
+
+	_, err := e.HandleMessage(context.Background(), []byte(testDedupText))
+	assert.Error(t, err)
+	// 处理失败后微信的重试会重新处理
+	reply, err := e.HandleMessage(context.Background(), []byte(testDedupText))
+	assert.Nil(t, err)
+	assert.Nil(t, reply)
+	assert.Equal(t, 2, calls)
+
+	reply, err = e.HandleMessage(context.Background(), []byte(testDedupText))
+	assert.Nil(t, err)
+	assert.Nil(t, reply)
+	assert.Equal(t, 2, calls)
+}
+
+func TestHandleMessageDedupTimeout(t *testing.T) {
+	timeout := dedupWaitTimeout
+	dedupWaitTimeout = 2 * dedupPollInterval
+	defer func() { dedupWaitTimeout = timeout }()
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	e := New(&WeiXinApiConfig{
+		AppToken:   "token",
+		DedupStore: &testDedupStore{entries: map[string]*DedupEntry{}},
+		HandleTextMessage: func(m *TextMessage) (Reply, error) {
+			close(started)
+			<-release
+			return &TextReply{Content: "slow"}, nil
+		},
+	})
+	go e.HandleMessage(context.Background(), []byte(testDedupText))
+	<-started
+
+	// 第一次推送一直没处理完，重试不能回复success，否则第一次推送的回复会丢失
+	reply, err := e.HandleMessage(context.Background(), []byte(testDedupText))
+	assert.Nil(t, reply)
+	assert.True(t, errors.Is(err, ErrDedupPending))
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, signedURL("token", nil), strings.NewReader(testDedupText)))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "success")
+}
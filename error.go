@@ -33,3 +33,33 @@ func (err *ErrInvalidEventType) Error() string {
 
 var ErrTokenInvalid = errors.New("AccessToken is invalid")
 var ErrRepoLocked = errors.New("Repository is already locked")
+
+// Is 错误码相同的ErrorMsg视为同一个错误，可以用errors.Is判断接口返回的错误码
+func (err *ErrorMsg) Is(target error) bool {
+	t, ok := target.(*ErrorMsg)
+	return ok && t.ErrCode == err.ErrCode
+}
+
+// BatchError 分批调用接口时部分批次失败，OpenIds为处理失败的用户
+type BatchError struct {
+	OpenIds []string
+	Err     error // 第一个出错批次的错误
+}
+
+func (err *BatchError) Error() string {
+	return fmt.Sprintf("%d个用户处理失败: %v", len(err.OpenIds), err.Err)
+}
+
+func (err *BatchError) Unwrap() error {
+	return err.Err
+}
+
+// ErrInvalidMenu 自定义菜单校验失败，Path为出错的菜单位置，如button[0].sub_button[1]
+type ErrInvalidMenu struct {
+	Path   string
+	Reason string
+}
+
+func (err *ErrInvalidMenu) Error() string {
+	return fmt.Sprintf("无效的菜单%s:%s", err.Path, err.Reason)
+}
@@ -40,6 +40,76 @@ type SubscribeEvent struct {
 	Ticket   string // 二维码的ticket，可用来换取二维码图片
 }
 
+// 扫码事件的扫描信息
+type ScanCodeInfo struct {
+	ScanType   string // 扫描类型，一般是qrcode
+	ScanResult string // 扫描结果，即二维码对应的字符串信息
+}
+
+// 扫码推事件 事件类型，scancode_push，扫码推事件且弹出“消息接收中”提示框 事件类型，scancode_waitmsg
+type ScanCodeEvent struct {
+	BaseEvent
+	EventKey     string       // 事件KEY值，由开发者在创建菜单时设定
+	ScanCodeInfo ScanCodeInfo // 扫描信息
+}
+
+// 发图事件中的一张图片
+type PicItem struct {
+	PicMd5Sum string // 图片的MD5值，开发者若需要，可用于验证接收到图片
+}
+
+// 发图事件的图片信息
+type SendPicsInfo struct {
+	Count   int       // 发送的图片数量
+	PicList []PicItem `xml:"PicList>item"` // 图片列表
+}
+
+// 弹出系统拍照发图的事件推送 事件类型，pic_sysphoto
+// 弹出拍照或者相册发图的事件推送 事件类型，pic_photo_or_album
+// 弹出微信相册发图器的事件推送 事件类型，pic_weixin
+type PicEvent struct {
+	BaseEvent
+	EventKey     string       // 事件KEY值，由开发者在创建菜单时设定
+	SendPicsInfo SendPicsInfo // 发送的图片信息
+}
+
+// 地理位置选择器事件的位置信息
+type SendLocationInfo struct {
+	LocationX float64 `xml:"Location_X"` // X坐标信息
+	LocationY float64 `xml:"Location_Y"` // Y坐标信息
+	Scale     int     // 精度，可理解为精度或者比例尺、越精细的话 scale越高
+	Label     string  // 地理位置的字符串信息
+	Poiname   string  // 朋友圈POI的名字，可能为空
+}
+
+// 弹出地理位置选择器的事件推送 事件类型，location_select
+type LocationSelectEvent struct {
+	BaseEvent
+	EventKey         string           // 事件KEY值，由开发者在创建菜单时设定
+	SendLocationInfo SendLocationInfo // 发送的位置信息
+}
+
+// 点击菜单跳转小程序的事件推送 事件类型，view_miniprogram
+type ViewMiniProgramEvent struct {
+	BaseEvent
+	EventKey string // 事件KEY值，跳转的小程序路径
+	MenuId   string // 菜单ID，如果是个性化菜单，则可以通过这个字段，知道是哪个规则的菜单被点击了
+}
+
+// 点击菜单跳转发布后的图文消息URL的事件推送 事件类型，article_view_limited
+type ArticleViewLimitedEvent struct {
+	BaseEvent
+	EventKey string // 事件KEY值，发布后的图文消息的article_id
+	MenuId   string // 菜单ID
+}
+
+// 模板消息发送任务完成后的事件推送 事件类型，TEMPLATESENDJOBFINISH
+type TemplateSendJobFinishEvent struct {
+	BaseEvent
+	MsgID  int64  // 模板消息的消息id
+	Status string // 发送状态，success、failed:user block、failed: system failed
+}
+
 // 事件类型，unsubscribe 事件类型，unsubscribe(取消订阅)
 type UnsubscribeEvent struct {
 	BaseEvent
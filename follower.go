@@ -0,0 +1,178 @@
+// 用户列表
+package weixin_api
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 遍历用户列表时默认的重试次数和间隔
+const (
+	DefaultIteratorRetries       = 3
+	DefaultIteratorRetryInterval = time.Second
+)
+
+// OpenIdList 一页openid列表，关注者列表、标签下粉丝列表和黑名单列表都使用这个格式
+type OpenIdList struct {
+	ErrorMsg
+	Total int32 `json:"total"` // 用户总数
+	Count int32 `json:"count"` // 拉取的openid个数
+	Data  struct {
+		OpenId []string `json:"openid"`
+	} `json:"data"` // 列表数据，openid的列表
+	NextOpenId string `json:"next_openid"` // 拉取列表的最后一个用户的openid
+}
+
+// OpenIdIterator 按页遍历openid列表，用法：
+//
+//	it := e.Followers("")
+//	for it.Next(ctx) {
+//		handle(it.OpenIds())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type OpenIdIterator struct {
+	MaxRetries    int           // 拉取一页失败时的重试次数，微信返回的错误码不重试
+	RetryInterval time.Duration // 重试间隔
+
+	fetch  func(ctx context.Context, cursor string) (*OpenIdList, error)
+	cursor string
+	page   []string
+	total  int32
+	err    error
+	done   bool
+}
+
+func newOpenIdIterator(cursor string, fetch func(ctx context.Context, cursor string) (*OpenIdList, error)) *OpenIdIterator {
+	return &OpenIdIterator{
+		MaxRetries:    DefaultIteratorRetries,
+		RetryInterval: DefaultIteratorRetryInterval,
+		fetch:         fetch,
+		cursor:        cursor,
+	}
+}
+
+// Next 拉取下一页，没有更多数据或出错时返回false
+func (it *OpenIdIterator) Next(ctx context.Context) bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	var list *OpenIdList
+	var err error
+	for i := 0; ; i++ {
+		list, err = it.fetch(ctx, it.cursor)
+		if err == nil {
+			break
+		}
+		var msg *ErrorMsg
+		if i >= it.MaxRetries || errors.As(err, &msg) || ctx.Err() != nil {
+			it.err = err
+			return false
+		}
+		select {
+		case <-time.After(it.RetryInterval):
+		case <-ctx.Done():
+			it.err = ctx.Err()
+			return false
+		}
+	}
+
+	it.total = list.Total
+	it.page = list.Data.OpenId
+	if len(it.page) == 0 {
+		it.done = true
+		return false
+	}
+	if list.NextOpenId == "" {
+		it.done = true
+	} else {
+		it.cursor = list.NextOpenId
+	}
+	return true
+}
+
+// OpenIds 当前页的openid
+func (it *OpenIdIterator) OpenIds() []string {
+	return it.page
+}
+
+// Total 用户总数
+func (it *OpenIdIterator) Total() int32 {
+	return it.total
+}
+
+// Cursor 当前页最后一个openid，保存下来后可以用来从下一页继续遍历
+func (it *OpenIdIterator) Cursor() string {
+	return it.cursor
+}
+
+// Err 遍历过程中出现的错误
+func (it *OpenIdIterator) Err() error {
+	return it.err
+}
+
+// GetFollowers 获取关注者列表，一次最多拉取10000个，nextOpenId为空时从头开始拉取
+func (e *Engine) GetFollowers(ctx context.Context, nextOpenId string) (*OpenIdList, error) {
+	// https://api.weixin.qq.com/cgi-bin/user/get?access_token=ACCESS_TOKEN&next_openid=NEXT_OPENID
+	info, err := getJSON[OpenIdList](ctx, e, "/cgi-bin/user/get?next_openid="+url.QueryEscape(nextOpenId))
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+// Followers 遍历关注者列表，cursor为空时从头开始，否则从cursor之后继续
+func (e *Engine) Followers(cursor string) *OpenIdIterator {
+	return newOpenIdIterator(cursor, e.GetFollowers)
+}
+
+// FollowerPage 导出关注者时的一页数据
+type FollowerPage struct {
+	OpenIds []string    // 本页的openid
+	Users   []*UserInfo // 本页用户的基本信息，只有开启WithUserInfo时才有
+	Total   int32       // 关注者总数
+	Cursor  string      // 本页之后的游标，保存下来用于中断后继续导出
+}
+
+// FollowerSink 接收导出的关注者，返回错误时停止导出
+type FollowerSink func(ctx context.Context, page *FollowerPage) error
+
+// ExportOptions 导出关注者的选项
+type ExportOptions struct {
+	Cursor       string // 从上次保存的游标继续导出，为空时从头开始
+	WithUserInfo bool   // 是否同时批量拉取用户基本信息
+	Lang         string // 用户信息的语言
+	Concurrency  int    // 拉取用户信息的并发数
+}
+
+// ExportFollowers 导出所有关注者，每拉取一页就交给sink处理，返回最后的游标。
+// 出错时返回的游标是最后一页成功处理后的位置，可以用来继续导出。
+func (e *Engine) ExportFollowers(ctx context.Context, sink FollowerSink, opts *ExportOptions) (string, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	cursor := opts.Cursor
+	it := e.Followers(cursor)
+	for it.Next(ctx) {
+		page := &FollowerPage{OpenIds: it.OpenIds(), Total: it.Total(), Cursor: it.Cursor()}
+		if opts.WithUserInfo {
+			users, err := e.BatchGetUserInfo(ctx, page.OpenIds, opts.Lang, opts.Concurrency)
+			if err != nil {
+				return cursor, errors.WithMessage(err, "BatchGetUserInfo")
+			}
+			page.Users = users
+		}
+		if err := sink(ctx, page); err != nil {
+			return cursor, err
+		}
+		cursor = page.Cursor
+	}
+	return cursor, it.Err()
+}
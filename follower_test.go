@@ -0,0 +1,62 @@
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportFollowers(t *testing.T) {
+	pages := map[string][]string{
+		"":  {"a", "b"},
+		"b": {"c", "d"},
+		"d": {"e"},
+		"e": nil,
+	}
+	failed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next := r.URL.Query().Get("next_openid")
+		if next == "b" && !failed {
+			failed = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var list OpenIdList
+		list.Total = 5
+		list.Data.OpenId = pages[next]
+		list.Count = int32(len(list.Data.OpenId))
+		if list.Count > 0 {
+			list.NextOpenId = list.Data.OpenId[list.Count-1]
+		}
+		json.NewEncoder(w).Encode(&list)
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+
+	var openIds []string
+	var cursors []string
+	cursor, err := e.ExportFollowers(context.Background(), func(ctx context.Context, page *FollowerPage) error {
+		openIds = append(openIds, page.OpenIds...)
+		cursors = append(cursors, page.Cursor)
+		return nil
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "e", cursor)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, openIds)
+	assert.Equal(t, []string{"b", "d", "e"}, cursors)
+	assert.True(t, failed)
+
+	// 从游标继续
+	it := e.Followers("d")
+	it.RetryInterval = time.Millisecond
+	assert.True(t, it.Next(context.Background()))
+	assert.Equal(t, []string{"e"}, it.OpenIds())
+	assert.False(t, it.Next(context.Background()))
+	assert.Nil(t, it.Err())
+}
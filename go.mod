@@ -3,14 +3,20 @@ module github.com/billyplus/weixin_api
 go 1.18
 
 require (
+	github.com/alicebob/miniredis/v2 v2.33.0
 	github.com/gomodule/redigo v1.8.8
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.7.1
 )
 
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rs/zerolog v1.26.1
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -17,6 +17,7 @@ const (
 	MsgTypeShortVideo = "shortvideo" // 小视频消息
 	MsgTypeLocation   = "location"   // 地理位置消息
 	MsgTypeLink       = "link"       // 链接消息
+	MsgTypeFile       = "file"       // 文件消息
 	MsgTypeEvent      = "event"      // 事件推送
 )
 
@@ -28,6 +29,17 @@ const (
 	EventTypeSubscribe   = "subscribe"   // 用户未关注
 	EventTypeUnsubscribe = "unsubscribe" // 取消订阅
 
+	EventTypeScanCodePush       = "scancode_push"        // 扫码推事件
+	EventTypeScanCodeWaitMsg    = "scancode_waitmsg"     // 扫码推事件且弹出“消息接收中”提示框
+	EventTypePicSysPhoto        = "pic_sysphoto"         // 弹出系统拍照发图
+	EventTypePicPhotoOrAlbum    = "pic_photo_or_album"   // 弹出拍照或者相册发图
+	EventTypePicWeixin          = "pic_weixin"           // 弹出微信相册发图器
+	EventTypeLocationSelect     = "location_select"      // 弹出地理位置选择器
+	EventTypeViewMiniProgram    = "view_miniprogram"     // 点菜单跳转小程序
+	EventTypeArticleViewLimited = "article_view_limited" // 点菜单跳转发布后的图文消息
+
+	EventTypeTemplateSendJobFinish = "TEMPLATESENDJOBFINISH" // 模板消息发送完成
+
 )
 
 var (
@@ -35,20 +47,57 @@ var (
 	ErrInvalidXMLToken = errors.New("xml解析token出错")
 )
 
-type TextMessageHandler func(m *TextMessage) error
-type ImageMessageHandler func(m *ImageMessage) error
-type VoiceMessageHandler func(m *VoiceMessage) error
-type VideoMessageHandler func(m *VideoMessage) error
-type LocationMessageHandler func(m *LocationMessage) error
-type LinkMessageHandler func(m *LinkMessage) error
-type ClickEventHandler func(m *ClickEvent) error
-type ViewEventHandler func(m *ViewEvent) error
-type LocationEventHandler func(m *LocationEvent) error
-type ScanEventHandler func(m *ScanEvent) error
-type SubscribeEventHandler func(m *SubscribeEvent) error
-type UnsubscribeEventHandler func(m *UnsubscribeEvent) error
-
-func (e *Engine) HandleMessage(c context.Context, data []byte) error {
+type TextMessageHandler func(m *TextMessage) (Reply, error)
+type ImageMessageHandler func(m *ImageMessage) (Reply, error)
+type VoiceMessageHandler func(m *VoiceMessage) (Reply, error)
+type VideoMessageHandler func(m *VideoMessage) (Reply, error)
+type ShortVideoMessageHandler func(m *VideoMessage) (Reply, error)
+type FileMessageHandler func(m *FileMessage) (Reply, error)
+type LocationMessageHandler func(m *LocationMessage) (Reply, error)
+type LinkMessageHandler func(m *LinkMessage) (Reply, error)
+type ClickEventHandler func(m *ClickEvent) (Reply, error)
+type ViewEventHandler func(m *ViewEvent) (Reply, error)
+type LocationEventHandler func(m *LocationEvent) (Reply, error)
+type ScanEventHandler func(m *ScanEvent) (Reply, error)
+type SubscribeEventHandler func(m *SubscribeEvent) (Reply, error)
+type UnsubscribeEventHandler func(m *UnsubscribeEvent) (Reply, error)
+type ScanCodePushEventHandler func(m *ScanCodeEvent) (Reply, error)
+type ScanCodeWaitMsgEventHandler func(m *ScanCodeEvent) (Reply, error)
+type PicSysPhotoEventHandler func(m *PicEvent) (Reply, error)
+type PicPhotoOrAlbumEventHandler func(m *PicEvent) (Reply, error)
+type PicWeixinEventHandler func(m *PicEvent) (Reply, error)
+type LocationSelectEventHandler func(m *LocationSelectEvent) (Reply, error)
+type ViewMiniProgramEventHandler func(m *ViewMiniProgramEvent) (Reply, error)
+type ArticleViewLimitedEventHandler func(m *ArticleViewLimitedEvent) (Reply, error)
+type TemplateSendJobFinishEventHandler func(m *TemplateSendJobFinishEvent) (Reply, error)
+
+// DefaultHandler 处理没有注册对应处理函数的消息，包括未知类型的消息，data为原始的xml，
+// msgType为消息类型，消息类型为event时event为事件类型
+type DefaultHandler func(msgType, event string, data []byte) (Reply, error)
+
+// HandleMessage 处理微信推送的消息，返回编码好的被动回复，处理函数没有回复时返回nil。
+// 设置了DedupStore时，重复推送的消息直接返回第一次的回复。
+func (e *Engine) HandleMessage(c context.Context, data []byte) ([]byte, error) {
+	if e.dedup != nil {
+		return e.handleMessageOnce(c, data)
+	}
+	return e.handleMessage(c, data)
+}
+
+func (e *Engine) handleMessage(c context.Context, data []byte) ([]byte, error) {
+	r, err := e.dispatchMessage(c, data)
+	if err != nil || isNilReply(r) {
+		// 处理函数返回nil指针也当作不回复
+		return nil, err
+	}
+	m, err := DecodeRawMessage[BaseMessage](data)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecodeBaseMessage")
+	}
+	return EncodeReply(m, r)
+}
+
+func (e *Engine) dispatchMessage(c context.Context, data []byte) (Reply, error) {
 	decoder := xml.NewDecoder(bytes.NewBuffer(data))
 	msgTyp := ""
 	evTyp := ""
@@ -92,23 +141,10 @@ LOOP:
 	}
 
 	if err != nil {
-		return errors.Wrap(err, "DecodeXML")
+		return nil, errors.Wrap(err, "DecodeXML")
 	}
 
-	switch msgTyp {
-	case MsgTypeText:
-		return handle(e.handleTextMessage, data)
-	case MsgTypeImage:
-		return handle(e.handleImageMessage, data)
-	case MsgTypeVoice:
-		return handle(e.handleVoiceMessage, data)
-	case MsgTypeVideo:
-		return handle(e.handleVideoMessage, data)
-	case MsgTypeLocation:
-		return handle(e.handleLocationMessage, data)
-	case MsgTypeLink:
-		return handle(e.handleLinkMessage, data)
-	case MsgTypeEvent:
+	if msgTyp == MsgTypeEvent {
 	LOOP_EVENT:
 		for {
 			// TODO：快速查找指定节点
@@ -146,84 +182,124 @@ LOOP:
 		}
 
 		if err != nil {
-			return errors.WithMessage(err, "DecodeMessageType")
-		}
-
-		switch evTyp {
-		case EventTypeSubscribe:
-			return handle(e.handleSubscribeEvent, data)
-		case EventTypeUnsubscribe:
-			return handle(e.handleUnsubscribeEvent, data)
-		case EventTypeClick:
-			return handle(e.handleClickEvent, data)
-		case EventTypeView:
-			return handle(e.handleViewEvent, data)
-		case EventTypeLocation:
-			return handle(e.handleLocationEvent, data)
-		case EventTypeScan:
-			return handle(e.handleScanEvent, data)
+			return nil, errors.WithMessage(err, "DecodeMessageType")
 		}
-		return &ErrInvalidEventType{Type: evTyp}
 	}
 
-	return &ErrInvalidMessageType{Type: msgTyp}
+	return e.router.Dispatch(&InboundMessage{Context: c, MsgType: msgTyp, Event: evTyp, Data: data})
 }
 
-func handle[T any](fn func(m *T) error, body []byte) error {
-	if fn == nil {
-		return ErrInvalidHandler
-	}
-	m, err := DecodeRawMessage[T](body)
-	if err != nil {
-		return err
-	}
-	return fn(m)
+// isUnhandledError 消息没有对应的处理函数，或者是未知的消息类型
+func isUnhandledError(err error) bool {
+	var msgTypErr *ErrInvalidMessageType
+	var evTypErr *ErrInvalidEventType
+	return errors.Is(err, ErrInvalidHandler) || errors.As(err, &msgTypErr) || errors.As(err, &evTypErr)
+}
+
+// Router 返回消息路由，可以用来添加中间件或注册自定义消息类型的处理函数
+func (e *Engine) Router() *Router {
+	return e.router
 }
 
 func (e *Engine) RegTextMessageHandler(h TextMessageHandler) {
-	e.handleTextMessage = h
+	On(e.router, MsgTypeText, "", h)
 }
 
 func (e *Engine) RegImageMessageHandler(h ImageMessageHandler) {
-	e.handleImageMessage = h
+	On(e.router, MsgTypeImage, "", h)
 }
 
 func (e *Engine) RegVoiceMessageHandler(h VoiceMessageHandler) {
-	e.handleVoiceMessage = h
+	On(e.router, MsgTypeVoice, "", h)
 }
 
 func (e *Engine) RegVideoMessageHandler(h VideoMessageHandler) {
-	e.handleVideoMessage = h
+	On(e.router, MsgTypeVideo, "", h)
+}
+
+func (e *Engine) RegShortVideoMessageHandler(h ShortVideoMessageHandler) {
+	On(e.router, MsgTypeShortVideo, "", h)
+}
+
+func (e *Engine) RegFileMessageHandler(h FileMessageHandler) {
+	On(e.router, MsgTypeFile, "", h)
 }
 
 func (e *Engine) RegLocationMessageHandler(h LocationMessageHandler) {
-	e.handleLocationMessage = h
+	On(e.router, MsgTypeLocation, "", h)
 }
 
 func (e *Engine) RegLinkMessageHandler(h LinkMessageHandler) {
-	e.handleLinkMessage = h
+	On(e.router, MsgTypeLink, "", h)
 }
 
 func (e *Engine) RegClickEventHandler(h ClickEventHandler) {
-	e.handleClickEvent = h
+	On(e.router, MsgTypeEvent, EventTypeClick, h)
 }
 
 func (e *Engine) RegViewEventHandler(h ViewEventHandler) {
-	e.handleViewEvent = h
+	On(e.router, MsgTypeEvent, EventTypeView, h)
 }
 
 func (e *Engine) RegLocationEventHandler(h LocationEventHandler) {
-	e.handleLocationEvent = h
+	On(e.router, MsgTypeEvent, EventTypeLocation, h)
 }
 
 func (e *Engine) RegScanEventHandler(h ScanEventHandler) {
-	e.handleScanEvent = h
+	On(e.router, MsgTypeEvent, EventTypeScan, h)
 }
 
 func (e *Engine) RegSubscribeEventHandler(h SubscribeEventHandler) {
-	e.handleSubscribeEvent = h
+	On(e.router, MsgTypeEvent, EventTypeSubscribe, h)
 }
 
 func (e *Engine) RegUnsubscribeEventHandler(h UnsubscribeEventHandler) {
-	e.handleUnsubscribeEvent = h
+	On(e.router, MsgTypeEvent, EventTypeUnsubscribe, h)
+}
+
+func (e *Engine) RegScanCodePushEventHandler(h ScanCodePushEventHandler) {
+	On(e.router, MsgTypeEvent, EventTypeScanCodePush, h)
+}
+
+func (e *Engine) RegScanCodeWaitMsgEventHandler(h ScanCodeWaitMsgEventHandler) {
+	On(e.router, MsgTypeEvent, EventTypeScanCodeWaitMsg, h)
+}
+
+func (e *Engine) RegPicSysPhotoEventHandler(h PicSysPhotoEventHandler) {
+	On(e.router, MsgTypeEvent, EventTypePicSysPhoto, h)
+}
+
+func (e *Engine) RegPicPhotoOrAlbumEventHandler(h PicPhotoOrAlbumEventHandler) {
+	On(e.router, MsgTypeEvent, EventTypePicPhotoOrAlbum, h)
+}
+
+func (e *Engine) RegPicWeixinEventHandler(h PicWeixinEventHandler) {
+	On(e.router, MsgTypeEvent, EventTypePicWeixin, h)
+}
+
+func (e *Engine) RegLocationSelectEventHandler(h LocationSelectEventHandler) {
+	On(e.router, MsgTypeEvent, EventTypeLocationSelect, h)
+}
+
+func (e *Engine) RegViewMiniProgramEventHandler(h ViewMiniProgramEventHandler) {
+	On(e.router, MsgTypeEvent, EventTypeViewMiniProgram, h)
+}
+
+func (e *Engine) RegArticleViewLimitedEventHandler(h ArticleViewLimitedEventHandler) {
+	On(e.router, MsgTypeEvent, EventTypeArticleViewLimited, h)
+}
+
+func (e *Engine) RegTemplateSendJobFinishEventHandler(h TemplateSendJobFinishEventHandler) {
+	On(e.router, MsgTypeEvent, EventTypeTemplateSendJobFinish, h)
+}
+
+// RegDefaultHandler 注册默认的处理函数，没有对应处理函数的消息都交给它处理，不再返回ErrInvalidHandler
+func (e *Engine) RegDefaultHandler(h DefaultHandler) {
+	if h == nil {
+		e.router.Fallback(nil)
+		return
+	}
+	e.router.Fallback(func(m *InboundMessage) (Reply, error) {
+		return h(m.MsgType, m.Event, m.Data)
+	})
 }
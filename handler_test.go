@@ -18,7 +18,267 @@ func TestHandleMessage(t *testing.T) {
 	<EventKey><![CDATA[qrscene_123123]]></EventKey>
 	<Ticket><![CDATA[TICKET]]></Ticket>
   </xml>`)
-	err := e.HandleMessage(context.Background(), body)
+	var ev *SubscribeEvent
+	e.RegSubscribeEventHandler(func(m *SubscribeEvent) (Reply, error) {
+		ev = m
+		return nil, nil
+	})
+	reply, err := e.HandleMessage(context.Background(), body)
 	assert.Nil(t, err, "should not return error")
-	assert.True(t, false)
+	assert.Nil(t, reply)
+	if assert.NotNil(t, ev) {
+		assert.Equal(t, "qrscene_123123", ev.EventKey)
+		assert.Equal(t, "TICKET", ev.Ticket)
+	}
+}
+
+func TestHandleMessageReply(t *testing.T) {
+	e := New(&WeiXinApiConfig{})
+	body := []byte(`<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[text]]></MsgType>
+	<Content><![CDATA[this is a test]]></Content>
+	<MsgId>1234567890123456</MsgId>
+  </xml>`)
+	e.RegTextMessageHandler(func(m *TextMessage) (Reply, error) {
+		return &TextReply{Content: "echo: " + m.Content}, nil
+	})
+	data, err := e.HandleMessage(context.Background(), body)
+	assert.Nil(t, err)
+
+	reply, err := DecodeRawMessage[TextMessage](data)
+	assert.Nil(t, err)
+	assert.Equal(t, "fromUser", reply.ToUserName)
+	assert.Equal(t, "toUser", reply.FromUserName)
+	assert.Equal(t, MsgTypeText, reply.MsgType)
+	assert.Equal(t, "echo: this is a test", reply.Content)
+	assert.Contains(t, string(data), "<Content><![CDATA[echo: this is a test]]></Content>")
+}
+
+func TestHandleMessageTypedNilReply(t *testing.T) {
+	e := New(&WeiXinApiConfig{})
+	body := []byte(`<xml><ToUserName><![CDATA[toUser]]></ToUserName><FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime><MsgType><![CDATA[text]]></MsgType><Content><![CDATA[hi]]></Content><MsgId>1</MsgId></xml>`)
+	e.RegTextMessageHandler(func(m *TextMessage) (Reply, error) {
+		var r *TextReply
+		return r, nil
+	})
+	// 返回nil指针当作不回复，不能panic
+	data, err := e.HandleMessage(context.Background(), body)
+	assert.Nil(t, err)
+	assert.Nil(t, data)
+
+	_, err = EncodeReply(&BaseMessage{}, (*NewsReply)(nil))
+	assert.NotNil(t, err)
+}
+
+func TestEncodeNewsReply(t *testing.T) {
+	m := &BaseMessage{ToUserName: "gh_1", FromUserName: "openid"}
+	data, err := EncodeReply(m, &NewsReply{Articles: []Article{{Title: "t", Description: "d", PicUrl: "p", Url: "u"}}})
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "<ArticleCount>1</ArticleCount><Articles><item><Title><![CDATA[t]]></Title>")
+	assert.Contains(t, string(data), "<MsgType><![CDATA[news]]></MsgType>")
+}
+
+func TestEncodeTransferCustomerServiceReply(t *testing.T) {
+	m := &BaseMessage{ToUserName: "gh_1", FromUserName: "openid"}
+	data, err := EncodeReply(m, &TransferCustomerServiceReply{KfAccount: "test1@test"})
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "<MsgType><![CDATA[transfer_customer_service]]></MsgType><TransInfo><KfAccount><![CDATA[test1@test]]></KfAccount></TransInfo>")
+}
+
+func TestHandleTemplateSendJobFinishEvent(t *testing.T) {
+	e := New(&WeiXinApiConfig{})
+	body := []byte(`<xml>
+	<ToUserName><![CDATA[gh_7f083739789a]]></ToUserName>
+	<FromUserName><![CDATA[oia2TjuEGTNoeX76QEjQNrcURxG8]]></FromUserName>
+	<CreateTime>1395658920</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[TEMPLATESENDJOBFINISH]]></Event>
+	<MsgID>200163836</MsgID>
+	<Status><![CDATA[failed:user block]]></Status>
+  </xml>`)
+	var ev *TemplateSendJobFinishEvent
+	e.RegTemplateSendJobFinishEventHandler(func(m *TemplateSendJobFinishEvent) (Reply, error) {
+		ev = m
+		return nil, nil
+	})
+	_, err := e.HandleMessage(context.Background(), body)
+	assert.Nil(t, err)
+	if assert.NotNil(t, ev) {
+		assert.Equal(t, int64(200163836), ev.MsgID)
+		assert.Equal(t, TemplateSendStatusUserBlock, ev.Status)
+	}
+}
+
+func TestHandleMenuEvents(t *testing.T) {
+	e := New(&WeiXinApiConfig{})
+	var scan *ScanCodeEvent
+	var pic *PicEvent
+	var loc *LocationSelectEvent
+	e.RegScanCodeWaitMsgEventHandler(func(m *ScanCodeEvent) (Reply, error) {
+		scan = m
+		return &TextReply{Content: m.ScanCodeInfo.ScanResult}, nil
+	})
+	e.RegPicPhotoOrAlbumEventHandler(func(m *PicEvent) (Reply, error) {
+		pic = m
+		return nil, nil
+	})
+	e.RegLocationSelectEventHandler(func(m *LocationSelectEvent) (Reply, error) {
+		loc = m
+		return nil, nil
+	})
+
+	reply, err := e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[gh_e136c6e50636]]></ToUserName>
+	<FromUserName><![CDATA[oMgHVjngRipVsoxg6TuX3vz6glDg]]></FromUserName>
+	<CreateTime>1408090606</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[scancode_waitmsg]]></Event>
+	<EventKey><![CDATA[6]]></EventKey>
+	<ScanCodeInfo><ScanType><![CDATA[qrcode]]></ScanType>
+	<ScanResult><![CDATA[2]]></ScanResult>
+	</ScanCodeInfo>
+	</xml>`))
+	assert.Nil(t, err)
+	assert.Contains(t, string(reply), "<Content><![CDATA[2]]></Content>")
+	if assert.NotNil(t, scan) {
+		assert.Equal(t, "6", scan.EventKey)
+		assert.Equal(t, "qrcode", scan.ScanCodeInfo.ScanType)
+	}
+
+	_, err = e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[gh_e136c6e50636]]></ToUserName>
+	<FromUserName><![CDATA[oMgHVjngRipVsoxg6TuX3vz6glDg]]></FromUserName>
+	<CreateTime>1408090816</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[pic_photo_or_album]]></Event>
+	<EventKey><![CDATA[6]]></EventKey>
+	<SendPicsInfo><Count>1</Count>
+	<PicList><item><PicMd5Sum><![CDATA[5a75aaca956d97be686719218f275c6b]]></PicMd5Sum>
+	</item>
+	</PicList>
+	</SendPicsInfo>
+	</xml>`))
+	assert.Nil(t, err)
+	if assert.NotNil(t, pic) {
+		assert.Equal(t, 1, pic.SendPicsInfo.Count)
+		assert.Equal(t, []PicItem{{PicMd5Sum: "5a75aaca956d97be686719218f275c6b"}}, pic.SendPicsInfo.PicList)
+	}
+
+	_, err = e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[gh_e136c6e50636]]></ToUserName>
+	<FromUserName><![CDATA[oMgHVjngRipVsoxg6TuX3vz6glDg]]></FromUserName>
+	<CreateTime>1408091189</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[location_select]]></Event>
+	<EventKey><![CDATA[6]]></EventKey>
+	<SendLocationInfo><Location_X><![CDATA[23]]></Location_X>
+	<Location_Y><![CDATA[113]]></Location_Y>
+	<Scale><![CDATA[15]]></Scale>
+	<Label><![CDATA[ 广州市海珠区客村艺苑路 106号]]></Label>
+	<Poiname><![CDATA[]]></Poiname>
+	</SendLocationInfo>
+	</xml>`))
+	assert.Nil(t, err)
+	if assert.NotNil(t, loc) {
+		assert.Equal(t, float64(23), loc.SendLocationInfo.LocationX)
+		assert.Equal(t, 15, loc.SendLocationInfo.Scale)
+	}
+
+	_, err = e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[FromUser]]></FromUserName>
+	<CreateTime>123456789</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[view_miniprogram]]></Event>
+	<EventKey><![CDATA[pages/index/index]]></EventKey>
+	<MenuId>MENUID</MenuId>
+	</xml>`))
+	assert.ErrorIs(t, err, ErrInvalidHandler)
+}
+
+func TestHandleShortVideoAndFileMessage(t *testing.T) {
+	e := New(&WeiXinApiConfig{})
+	var video *VideoMessage
+	var file *FileMessage
+	e.RegShortVideoMessageHandler(func(m *VideoMessage) (Reply, error) {
+		video = m
+		return nil, nil
+	})
+	e.RegFileMessageHandler(func(m *FileMessage) (Reply, error) {
+		file = m
+		return nil, nil
+	})
+
+	_, err := e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1357290913</CreateTime>
+	<MsgType><![CDATA[shortvideo]]></MsgType>
+	<MediaId><![CDATA[media_id]]></MediaId>
+	<ThumbMediaId><![CDATA[thumb_media_id]]></ThumbMediaId>
+	<MsgId>1234567890123456</MsgId>
+	</xml>`))
+	assert.Nil(t, err)
+	if assert.NotNil(t, video) {
+		assert.Equal(t, MsgTypeShortVideo, video.MsgType)
+		assert.Equal(t, "thumb_media_id", video.ThumbMediaId)
+	}
+
+	_, err = e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1482908900</CreateTime>
+	<MsgType><![CDATA[file]]></MsgType>
+	<Title><![CDATA[report.pdf]]></Title>
+	<Description><![CDATA[]]></Description>
+	<FileKey><![CDATA[key]]></FileKey>
+	<FileMd5><![CDATA[5a75aaca956d97be686719218f275c6b]]></FileMd5>
+	<FileTotalLen>2048</FileTotalLen>
+	<MsgId>1234567890123457</MsgId>
+	</xml>`))
+	assert.Nil(t, err)
+	if assert.NotNil(t, file) {
+		assert.Equal(t, "report.pdf", file.Title)
+		assert.Equal(t, int64(2048), file.FileTotalLen)
+	}
+}
+
+func TestDefaultHandler(t *testing.T) {
+	var gotMsgType, gotEvent string
+	var gotData []byte
+	e := New(&WeiXinApiConfig{
+		HandleDefault: func(msgType, event string, data []byte) (Reply, error) {
+			gotMsgType, gotEvent, gotData = msgType, event, data
+			return &TextReply{Content: "default"}, nil
+		},
+	})
+	body := []byte(`<xml><ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>123456789</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[unknown_event]]></Event>
+	</xml>`)
+	reply, err := e.HandleMessage(context.Background(), body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(reply), "<Content><![CDATA[default]]></Content>")
+	assert.Equal(t, MsgTypeEvent, gotMsgType)
+	assert.Equal(t, "unknown_event", gotEvent)
+	assert.Equal(t, body, gotData)
+
+	// 注册了处理函数的消息不会交给默认处理函数
+	gotMsgType = ""
+	e.RegTextMessageHandler(func(m *TextMessage) (Reply, error) {
+		return nil, nil
+	})
+	_, err = e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>123456789</CreateTime>
+	<MsgType><![CDATA[text]]></MsgType>
+	<Content><![CDATA[hi]]></Content>
+	</xml>`))
+	assert.Nil(t, err)
+	assert.Equal(t, "", gotMsgType)
+
+	_, err = e.HandleMessage(context.Background(), []byte(`<xml><MsgType><![CDATA[image]]></MsgType></xml>`))
+	assert.Nil(t, err)
+	assert.Equal(t, MsgTypeImage, gotMsgType)
+	assert.Equal(t, "", gotEvent)
 }
@@ -2,76 +2,85 @@ package weixin_api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 )
 
-func HttpGet[T any](url string) (*T, error) {
-	request, err := http.NewRequest("GET", url, nil)
+// HttpGet 用client发送GET请求并按JSON解析回包，client为nil时使用http.DefaultClient。
+// 调用微信接口时传入Engine.HttpClient()，保证使用配置的超时和代理。
+func HttpGet[T any](ctx context.Context, client *http.Client, url string) (*T, error) {
+	data, err := HttpGetRaw(ctx, client, url)
 	if err != nil {
-		log.Error().Err(err).Msg("[reloadGameConfig]新建http请求失败")
 		return nil, err
 	}
 
-	res, err := http.DefaultClient.Do(request)
-	if err != nil {
-		log.Error().Err(err).Str("url", url).Msg("[reloadGameConfig]发送http请求失败")
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		log.Error().Err(err).Msg("[reloadGameConfig]无法访问Admin服务器")
-		return nil, errors.New(res.Status)
-	}
-	data, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		log.Error().Err(err).Msg("[reloadGameConfig]读取http回包失败")
-		return nil, errors.Wrap(err, "无法读取回包")
-	}
-
 	var resp T
 	if err = json.Unmarshal(data, &resp); err != nil {
-		log.Error().Bytes("data", data).Msg("[reloadGameConfig]failed parse body")
+		log.Error().Bytes("data", data).Msg("[HttpGet]failed parse body")
 		return nil, errors.Wrap(err, "无法解析回包")
 	}
 
 	return &resp, nil
 }
 
-func HttpGetRaw(url string) ([]byte, error) {
-	request, err := http.NewRequest("GET", url, nil)
+// HttpGetRaw 用client发送GET请求并返回回包，client为nil时使用http.DefaultClient
+func HttpGetRaw(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		log.Error().Err(err).Msg("[reloadGameConfig]新建http请求失败")
+		err = redactError(err)
+		log.Error().Err(err).Msg("[HttpGetRaw]新建http请求失败")
 		return nil, err
 	}
 
-	res, err := http.DefaultClient.Do(request)
+	res, err := httpClient(client).Do(request)
 	if err != nil {
-		log.Error().Err(err).Str("url", url).Msg("[reloadGameConfig]发送http请求失败")
+		err = redactError(err)
+		log.Error().Err(err).Str("url", redactURL(url)).Msg("[HttpGetRaw]发送http请求失败")
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		log.Error().Err(err).Msg("[reloadGameConfig]无法访问Admin服务器")
+		log.Error().Str("url", redactURL(url)).Int("status", res.StatusCode).Msg("[HttpGetRaw]请求失败")
 		return nil, errors.New(res.Status)
 	}
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		log.Error().Err(err).Msg("[reloadGameConfig]读取http回包失败")
+		log.Error().Err(err).Msg("[HttpGetRaw]读取http回包失败")
 		return nil, errors.Wrap(err, "无法读取回包")
 	}
 
 	return data, nil
 }
 
-func PostJSON[T any](url string, body interface{}) (*T, error) {
+// PostJSON 用client发送POST请求并按JSON解析回包，client为nil时使用http.DefaultClient。
+// body为io.Reader或[]byte时直接发送，否则编码成JSON后发送。
+func PostJSON[T any](ctx context.Context, client *http.Client, url string, body interface{}) (*T, error) {
+	data, err := PostJSONReturnRaw(ctx, client, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp T
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	return &resp, nil
+}
+
+// PostJSONReturnRaw 和PostJSON一样发送请求，返回未解析的回包
+func PostJSONReturnRaw(ctx context.Context, client *http.Client, url string, body interface{}) ([]byte, error) {
 	var bd io.Reader
 	var ok bool
 	bd, ok = body.(io.Reader)
@@ -86,19 +95,19 @@ func PostJSON[T any](url string, body interface{}) (*T, error) {
 			bd = bytes.NewBuffer(data)
 		}
 	}
-	request, err := http.NewRequest(http.MethodPost, url, bd)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bd)
 	if err != nil {
-		return nil, errors.Wrap(err, "http.NewRequest:")
+		return nil, errors.Wrap(redactError(err), "http.NewRequest:")
 	}
 
-	res, err := http.DefaultClient.Do(request)
+	res, err := httpClient(client).Do(request)
 	if err != nil {
-		return nil, errors.Wrap(err, "Request.Do:")
+		return nil, errors.Wrap(redactError(err), "Request.Do:")
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		log.Error().Err(err).Msg("[reloadGameConfig]无法访问Admin服务器")
+		log.Error().Str("url", redactURL(url)).Int("status", res.StatusCode).Msg("[PostJSON]请求失败")
 		return nil, errors.New(res.Status)
 	}
 	data, err := ioutil.ReadAll(res.Body)
@@ -106,48 +115,374 @@ func PostJSON[T any](url string, body interface{}) (*T, error) {
 		return nil, errors.Wrap(err, "ioutil.ReadAll")
 	}
 
-	var resp T
-	if err = json.Unmarshal(data, &resp); err != nil {
-		return nil, errors.Wrap(err, "json.Unmarshal")
+	return data, nil
+}
+
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return http.DefaultClient
 	}
+	return client
+}
 
-	return &resp, nil
+// 微信API的备用域名，主域名出现网络错误或5xx时依次尝试
+var BackupDomains = []string{
+	"api2.weixin.qq.com",
+	"sh.api.weixin.qq.com",
+	"sz.api.weixin.qq.com",
+	"hk.api.weixin.qq.com",
 }
 
-func PostJSONReturnRaw(url string, body interface{}) ([]byte, error) {
-	var bd io.Reader
-	var ok bool
-	bd, ok = body.(io.Reader)
-	if !ok {
-		if data, ok := body.([]byte); ok {
-			bd = bytes.NewBuffer(data)
-		} else {
-			data, err := json.Marshal(body)
-			if err != nil {
-				return nil, errors.Wrap(err, "json.Marshal:")
-			}
-			bd = bytes.NewBuffer(data)
+// 把域名转换成带scheme的地址，已经带有scheme时原样返回
+func domainToURL(domain string) string {
+	if strings.HasPrefix(domain, "http://") || strings.HasPrefix(domain, "https://") {
+		return strings.TrimSuffix(domain, "/")
+	}
+	return "https://" + domain
+}
+
+func marshalBody(body interface{}) ([]byte, error) {
+	switch v := body.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case io.Reader:
+		data, err := ioutil.ReadAll(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "ioutil.ReadAll:")
 		}
+		return data, nil
 	}
-	request, err := http.NewRequest(http.MethodPost, url, bd)
+	data, err := json.Marshal(body)
 	if err != nil {
-		return nil, errors.Wrap(err, "http.NewRequest:")
+		return nil, errors.Wrap(err, "json.Marshal:")
 	}
+	return data, nil
+}
 
-	res, err := http.DefaultClient.Do(request)
+// 日志和错误中需要隐藏的参数
+var sensitiveParams = []string{"secret", "access_token", "js_code"}
+
+// redactURL 隐藏url中的AppSecret、access_token等敏感参数，用于日志和返回的错误
+func redactURL(rawURL string) string {
+	i := strings.IndexByte(rawURL, '?')
+	if i < 0 {
+		return rawURL
+	}
+	query, err := url.ParseQuery(rawURL[i+1:])
 	if err != nil {
-		return nil, errors.Wrap(err, "Request.Do:")
+		return rawURL[:i]
 	}
-	defer res.Body.Close()
+	for _, key := range sensitiveParams {
+		if query.Has(key) {
+			query.Set(key, "REDACTED")
+		}
+	}
+	return rawURL[:i+1] + query.Encode()
+}
 
-	if res.StatusCode != http.StatusOK {
-		log.Error().Err(err).Msg("[reloadGameConfig]无法访问Admin服务器")
-		return nil, errors.New(res.Status)
+// redactError 隐藏http.Client返回的*url.Error中的敏感参数
+func redactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactURL(urlErr.URL)
+	}
+	return err
+}
+
+// 请求体，每次发送（包括切换域名和重试）时调用一次，返回新的io.Reader
+type bodyFunc func() (io.Reader, error)
+
+func bytesBody(data []byte) bodyFunc {
+	if data == nil {
+		return nil
+	}
+	return func() (io.Reader, error) {
+		return bytes.NewReader(data), nil
+	}
+}
+
+// 请求体无法重新读取时返回的错误
+var ErrBodyNotRewindable = errors.New("请求体不支持Seek，无法重发")
+
+// 以流的方式把文件编码成multipart/form-data，文件内容不会读入内存。
+// r实现了io.Seeker时，重试前会回到原来的位置，否则只能发送一次。
+func multipartBody(fieldName, filename string, r io.Reader, fields map[string]string) (bodyFunc, string) {
+	boundary := multipart.NewWriter(ioutil.Discard).Boundary()
+	var offset int64
+	var prev *io.PipeReader
+	var done chan struct{}
+	body := func() (io.Reader, error) {
+		seeker, canSeek := r.(io.Seeker)
+		if prev != nil {
+			if !canSeek {
+				return nil, ErrBodyNotRewindable
+			}
+			// 等待上一次写入的goroutine退出后再重新读取文件
+			prev.Close()
+			<-done
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return nil, errors.Wrap(err, "Seek")
+			}
+		} else if canSeek {
+			pos, err := seeker.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, errors.Wrap(err, "Seek")
+			}
+			offset = pos
+		}
+
+		pr, pw := io.Pipe()
+		prev, done = pr, make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			mw := multipart.NewWriter(pw)
+			err := mw.SetBoundary(boundary)
+			for k, v := range fields {
+				if err != nil {
+					break
+				}
+				err = mw.WriteField(k, v)
+			}
+			if err == nil {
+				var part io.Writer
+				if part, err = mw.CreateFormFile(fieldName, filename); err == nil {
+					if _, err = io.Copy(part, r); err == nil {
+						err = mw.Close()
+					}
+				}
+			}
+			pw.CloseWithError(err)
+		}(done)
+		// 返回*io.PipeReader，请求结束或出错时http.Client会关闭它，写入的goroutine随之退出
+		return pr, nil
+	}
+	return body, "multipart/form-data; boundary=" + boundary
+}
+
+// 向微信API服务器发送请求，path为不带域名的路径，返回状态码为200的回包，调用方负责关闭Body。
+// 开启容灾时，遇到网络错误或5xx会依次切换到备用域名重试。POST请求可能已经被服务器处理，
+// 只有连接服务器失败时才切换域名，避免重复发送消息。
+func (e *Engine) send(ctx context.Context, method, path, contentType string, body bodyFunc) (*http.Response, error) {
+	var lastErr error
+	for _, domain := range e.domains {
+		var bd io.Reader
+		if body != nil {
+			var err error
+			if bd, err = body(); err != nil {
+				if lastErr != nil {
+					return nil, lastErr
+				}
+				return nil, err
+			}
+		}
+		request, err := http.NewRequestWithContext(ctx, method, domain+path, bd)
+		if err != nil {
+			// 关闭body，multipartBody返回的io.PipeReader关闭后写入的goroutine才会退出
+			if c, ok := bd.(io.Closer); ok {
+				c.Close()
+			}
+			return nil, errors.Wrap(redactError(err), "http.NewRequest:")
+		}
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+
+		res, err := e.client.Do(request)
+		if err != nil {
+			err = redactError(err)
+			if ctx.Err() != nil {
+				// 超时或被取消时不再切换域名
+				return nil, errors.Wrap(err, "Request.Do:")
+			}
+			log.Warn().Err(err).Str("domain", domain).Str("path", redactURL(path)).Msg("[send]发送http请求失败")
+			lastErr = errors.Wrap(err, "Request.Do:")
+			if !canRetry(method) && !isDialError(err) {
+				// 请求可能已经被处理，重发会导致重复发送消息
+				return nil, lastErr
+			}
+			continue
+		}
+		if res.StatusCode >= http.StatusInternalServerError {
+			res.Body.Close()
+			log.Warn().Str("domain", domain).Str("path", redactURL(path)).Int("status", res.StatusCode).Msg("[send]微信服务器错误")
+			lastErr = errors.New(res.Status)
+			if !canRetry(method) {
+				return nil, lastErr
+			}
+			continue
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, errors.New(res.Status)
+		}
+		return res, nil
+	}
+	return nil, lastErr
+}
+
+// 可以重复发送的请求，GET请求只查询数据，重发不会产生副作用
+func canRetry(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// 连接服务器失败，包括DNS解析失败，请求一定没有发送到服务器
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+func readResponse(res *http.Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
 	}
+	defer res.Body.Close()
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return nil, errors.Wrap(err, "ioutil.ReadAll")
 	}
-
 	return data, nil
 }
+
+// 发送请求并读取整个回包
+func (e *Engine) doRequest(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	return readResponse(e.send(ctx, method, path, contentType, bytesBody(body)))
+}
+
+// access_token失效相关的错误码
+const (
+	ErrCodeInvalidCredential  = 40001 // 获取access_token时AppSecret错误，或者access_token无效
+	ErrCodeInvalidAccessToken = 40014 // 不合法的access_token
+	ErrCodeAccessTokenExpired = 42001 // access_token超时
+)
+
+func isTokenInvalid(code int32) bool {
+	return code == ErrCodeInvalidCredential || code == ErrCodeInvalidAccessToken || code == ErrCodeAccessTokenExpired
+}
+
+func withAccessToken(path, tok string) string {
+	if strings.Contains(path, "?") {
+		return path + "&access_token=" + tok
+	}
+	return path + "?access_token=" + tok
+}
+
+// 回包是否为文件内容，文件内容不检查errcode
+func isFileResponse(res *http.Response) bool {
+	if res.Header.Get("Content-Disposition") != "" {
+		return true
+	}
+	ct := res.Header.Get("Content-Type")
+	for _, prefix := range []string{"image/", "audio/", "video/", "application/octet-stream"} {
+		if strings.HasPrefix(ct, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 调用需要access_token的接口，path中不需要带access_token。
+// 微信返回token失效的错误码时，把缓存的token标记为失效并重新获取，然后重试一次。
+// 回包不是文件内容时已经读入内存，调用方同样需要关闭Body。
+func (e *Engine) sendWithToken(ctx context.Context, method, path, contentType string, body bodyFunc) (*http.Response, error) {
+	tok, err := e.GetAccessToken(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "GetAccessToken:")
+	}
+	for retried := false; ; retried = true {
+		res, err := e.send(ctx, method, withAccessToken(path, tok), contentType, body)
+		if err != nil || isFileResponse(res) {
+			return res, err
+		}
+		data, err := readResponse(res, nil)
+		if err != nil {
+			return nil, err
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+		var msg ErrorMsg
+		if retried || json.Unmarshal(data, &msg) != nil || !isTokenInvalid(msg.ErrCode) {
+			return res, nil
+		}
+
+		log.Warn().Int32("errcode", msg.ErrCode).Str("path", path).Msg("[sendWithToken]access_token失效，重新获取")
+		if err = e.repo.InvalidateAccessToken(ctx, tok); err != nil {
+			return nil, errors.WithMessage(err, "repo.InvalidateAccessToken")
+		}
+		// token已经失效时GetAccessToken会重新获取，其他调用方正在获取时等待它完成，
+		// 已经被其他调用方更新时直接返回新的token
+		newTok, err := e.GetAccessToken(ctx)
+		if err != nil {
+			return nil, errors.Wrap(ErrTokenInvalid, err.Error())
+		}
+		if newTok == tok {
+			return nil, errors.Wrap(ErrTokenInvalid, "access_token没有更新")
+		}
+		tok = newTok
+	}
+}
+
+// 调用需要access_token的接口并读取整个回包
+func (e *Engine) doRequestWithToken(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	return readResponse(e.sendWithToken(ctx, method, path, contentType, bytesBody(body)))
+}
+
+// 以multipart/form-data上传文件，调用需要access_token的接口
+func uploadJSON[T any](ctx context.Context, e *Engine, path, fieldName, filename string, r io.Reader, fields map[string]string) (*T, error) {
+	body, contentType := multipartBody(fieldName, filename, r, fields)
+	return decodeJSON[T](readResponse(e.sendWithToken(ctx, http.MethodPost, path, contentType, body)))
+}
+
+func decodeJSON[T any](data []byte, err error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	var resp T
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+	return &resp, nil
+}
+
+// 用GET方法调用需要access_token的接口
+func getJSON[T any](ctx context.Context, e *Engine, path string) (*T, error) {
+	return decodeJSON[T](e.doRequestWithToken(ctx, http.MethodGet, path, "", nil))
+}
+
+// 用POST方法调用需要access_token的接口
+func postJSON[T any](ctx context.Context, e *Engine, path string, body interface{}) (*T, error) {
+	bd, err := marshalBody(body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[T](e.doRequestWithToken(ctx, http.MethodPost, path, "application/json", bd))
+}
+
+// 用POST方法调用只返回errcode的接口，errcode不为0时返回*ErrorMsg
+func postJSONCheck(ctx context.Context, e *Engine, path string, body interface{}) error {
+	info, err := postJSON[ErrorMsg](ctx, e, path, body)
+	if err != nil {
+		return errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return errors.WithStack(info)
+	}
+	return nil
+}
+
+// 用GET方法调用只返回errcode的接口，errcode不为0时返回*ErrorMsg
+func getJSONCheck(ctx context.Context, e *Engine, path string) error {
+	info, err := getJSON[ErrorMsg](ctx, e, path)
+	if err != nil {
+		return errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return errors.WithStack(info)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// 按关键字路由文本消息和菜单点击事件
+package weixin_api
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// KeywordMessage 匹配到关键字的消息，Text和Click只有一个不为nil
+type KeywordMessage struct {
+	Content string       // 用来匹配的内容，文本消息的Content或者菜单点击的EventKey，已去掉首尾空白
+	Args    string       // 前缀匹配时去掉前缀后的内容
+	Matches []string     // 正则匹配时的匹配结果，Matches[0]为整个匹配
+	Text    *TextMessage // 文本消息
+	Click   *ClickEvent  // 菜单点击事件
+}
+
+// KeywordHandler 处理匹配到关键字的消息
+type KeywordHandler func(m *KeywordMessage) (Reply, error)
+
+// ReplyWith 返回固定回复的KeywordHandler
+func ReplyWith(r Reply) KeywordHandler {
+	return func(m *KeywordMessage) (Reply, error) {
+		return r, nil
+	}
+}
+
+type keywordRoute struct {
+	priority int
+	match    func(m *KeywordMessage) bool
+	handler  KeywordHandler
+}
+
+// KeywordRouter 按关键字匹配文本消息的内容和菜单点击的EventKey，菜单和文字命令可以共用处理函数。
+// priority越大越先匹配，相同时按注册顺序匹配。用法：
+//
+//	kr := NewKeywordRouter().
+//		Exact("帮助", 0, ReplyWith(&TextReply{Content: "..."})).
+//		Prefix("查询", 0, handleQuery)
+//	e.RegTextMessageHandler(kr.HandleText)
+//	e.RegClickEventHandler(kr.HandleClick)
+type KeywordRouter struct {
+	routes   []*keywordRoute
+	fallback KeywordHandler
+}
+
+func NewKeywordRouter() *KeywordRouter {
+	return &KeywordRouter{}
+}
+
+func (r *KeywordRouter) add(priority int, match func(m *KeywordMessage) bool, h KeywordHandler) *KeywordRouter {
+	r.routes = append(r.routes, &keywordRoute{priority: priority, match: match, handler: h})
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return r.routes[i].priority > r.routes[j].priority
+	})
+	return r
+}
+
+// Exact 内容和keyword完全相同时匹配
+func (r *KeywordRouter) Exact(keyword string, priority int, h KeywordHandler) *KeywordRouter {
+	return r.add(priority, func(m *KeywordMessage) bool {
+		return m.Content == keyword
+	}, h)
+}
+
+// Prefix 内容以prefix开头时匹配，去掉前缀后的内容放在Args中
+func (r *KeywordRouter) Prefix(prefix string, priority int, h KeywordHandler) *KeywordRouter {
+	return r.add(priority, func(m *KeywordMessage) bool {
+		if !strings.HasPrefix(m.Content, prefix) {
+			return false
+		}
+		m.Args = strings.TrimSpace(strings.TrimPrefix(m.Content, prefix))
+		return true
+	}, h)
+}
+
+// Regexp 内容匹配正则表达式时匹配，匹配结果放在Matches中
+func (r *KeywordRouter) Regexp(re *regexp.Regexp, priority int, h KeywordHandler) *KeywordRouter {
+	return r.add(priority, func(m *KeywordMessage) bool {
+		m.Matches = re.FindStringSubmatch(m.Content)
+		return m.Matches != nil
+	}, h)
+}
+
+// Fallback 没有匹配到任何关键字时的处理函数
+func (r *KeywordRouter) Fallback(h KeywordHandler) *KeywordRouter {
+	r.fallback = h
+	return r
+}
+
+// Dispatch 按优先级查找第一个匹配的处理函数，都不匹配且没有Fallback时不回复
+func (r *KeywordRouter) Dispatch(m *KeywordMessage) (Reply, error) {
+	m.Content = strings.TrimSpace(m.Content)
+	for _, route := range r.routes {
+		if route.match(m) {
+			return route.handler(m)
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback(m)
+	}
+	return nil, nil
+}
+
+// HandleText 匹配文本消息的内容，可以注册为TextMessageHandler
+func (r *KeywordRouter) HandleText(m *TextMessage) (Reply, error) {
+	return r.Dispatch(&KeywordMessage{Content: m.Content, Text: m})
+}
+
+// HandleClick 匹配菜单点击事件的EventKey，可以注册为ClickEventHandler
+func (r *KeywordRouter) HandleClick(m *ClickEvent) (Reply, error) {
+	return r.Dispatch(&KeywordMessage{Content: m.EventKey, Click: m})
+}
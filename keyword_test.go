@@ -0,0 +1,76 @@
+package weixin_api
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywordRouter(t *testing.T) {
+	kr := NewKeywordRouter().
+		Prefix("查询", 0, func(m *KeywordMessage) (Reply, error) {
+			return &TextReply{Content: "prefix:" + m.Args}, nil
+		}).
+		Exact("查询订单", 10, ReplyWith(&TextReply{Content: "orders"})).
+		Regexp(regexp.MustCompile(`^#(\d+)$`), 0, func(m *KeywordMessage) (Reply, error) {
+			return &TextReply{Content: "id:" + m.Matches[1]}, nil
+		}).
+		Fallback(ReplyWith(&TextReply{Content: "unknown"}))
+
+	cases := map[string]string{
+		" 查询订单 ":  "orders",
+		"查询 物流":   "prefix:物流",
+		"#42":     "id:42",
+		"#42a":    "unknown",
+		"hello":   "unknown",
+		"查询订单123": "prefix:订单123",
+	}
+	for content, want := range cases {
+		r, err := kr.HandleText(&TextMessage{Content: content})
+		assert.Nil(t, err)
+		assert.Equal(t, want, r.(*TextReply).Content, content)
+	}
+
+	r, err := NewKeywordRouter().HandleText(&TextMessage{Content: "hello"})
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+}
+
+func TestKeywordRouterClick(t *testing.T) {
+	var got *KeywordMessage
+	kr := NewKeywordRouter().Exact("V1001_GOOD", 0, func(m *KeywordMessage) (Reply, error) {
+		got = m
+		return &TextReply{Content: "thanks"}, nil
+	})
+	e := New(&WeiXinApiConfig{})
+	e.RegTextMessageHandler(kr.HandleText)
+	e.RegClickEventHandler(kr.HandleClick)
+
+	reply, err := e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[FromUser]]></FromUserName>
+	<CreateTime>123456789</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[CLICK]]></Event>
+	<EventKey><![CDATA[V1001_GOOD]]></EventKey>
+	</xml>`))
+	assert.Nil(t, err)
+	assert.Contains(t, string(reply), "<Content><![CDATA[thanks]]></Content>")
+	if assert.NotNil(t, got) {
+		assert.NotNil(t, got.Click)
+		assert.Nil(t, got.Text)
+		assert.Equal(t, "FromUser", got.Click.FromUserName)
+	}
+
+	reply, err = e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[text]]></MsgType>
+	<Content><![CDATA[V1001_GOOD]]></Content>
+	<MsgId>1234567890123456</MsgId>
+	</xml>`))
+	assert.Nil(t, err)
+	assert.Contains(t, string(reply), "<Content><![CDATA[thanks]]></Content>")
+	assert.NotNil(t, got.Text)
+}
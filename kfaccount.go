@@ -0,0 +1,110 @@
+// 客服帐号管理
+package weixin_api
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// KfInfo 客服基本信息
+type KfInfo struct {
+	KfAccount        string `json:"kf_account"`         // 完整客服帐号，格式为：帐号前缀@公众号微信号
+	KfNick           string `json:"kf_nick"`            // 客服昵称
+	KfId             string `json:"kf_id"`              // 客服编号
+	KfHeadImgUrl     string `json:"kf_headimgurl"`      // 客服头像
+	KfWx             string `json:"kf_wx"`              // 如果客服帐号已绑定了客服人员微信号， 则此处显示微信号
+	InviteWx         string `json:"invite_wx"`          // 如果客服帐号尚未绑定微信号，但是已经发起了一个绑定邀请， 则此处显示绑定邀请的微信号
+	InviteExpireTime int64  `json:"invite_expire_time"` // 如果客服帐号尚未绑定微信号，但是已经发起过一个绑定邀请， 邀请的过期时间，为unix 时间戳
+	InviteStatus     string `json:"invite_status"`      // 邀请的状态，有等待确认“waiting”，被拒绝“rejected”， 过期“expired”
+}
+
+// KfOnlineInfo 在线客服信息
+type KfOnlineInfo struct {
+	KfAccount    string `json:"kf_account"`    // 完整客服帐号
+	Status       int32  `json:"status"`        // 客服在线状态，目前为：1、web 在线
+	KfId         string `json:"kf_id"`         // 客服编号
+	AcceptedCase int32  `json:"accepted_case"` // 客服当前正在接待的会话数
+}
+
+type reqKfAccount struct {
+	KfAccount string `json:"kf_account"`
+	Nickname  string `json:"nickname,omitempty"`
+	InviteWx  string `json:"invite_wx,omitempty"`
+}
+
+// AddKfAccount 添加客服帐号，account格式为：帐号前缀@公众号微信号
+func (e *Engine) AddKfAccount(ctx context.Context, account, nickname string) error {
+	// https://api.weixin.qq.com/customservice/kfaccount/add?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/customservice/kfaccount/add", &reqKfAccount{KfAccount: account, Nickname: nickname})
+}
+
+// UpdateKfAccount 设置客服信息
+func (e *Engine) UpdateKfAccount(ctx context.Context, account, nickname string) error {
+	// https://api.weixin.qq.com/customservice/kfaccount/update?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/customservice/kfaccount/update", &reqKfAccount{KfAccount: account, Nickname: nickname})
+}
+
+// InviteKfWorker 邀请绑定客服帐号，inviteWx为接收绑定邀请的客服微信号
+func (e *Engine) InviteKfWorker(ctx context.Context, account, inviteWx string) error {
+	// https://api.weixin.qq.com/customservice/kfaccount/inviteworker?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/customservice/kfaccount/inviteworker", &reqKfAccount{KfAccount: account, InviteWx: inviteWx})
+}
+
+// DeleteKfAccount 删除客服帐号
+func (e *Engine) DeleteKfAccount(ctx context.Context, account string) error {
+	// https://api.weixin.qq.com/customservice/kfaccount/del?access_token=ACCESS_TOKEN&kf_account=KFACCOUNT
+	return getJSONCheck(ctx, e, "/customservice/kfaccount/del?kf_account="+url.QueryEscape(account))
+}
+
+// UploadKfHeadImg 上传客服头像，头像图片文件必须是jpg格式，推荐使用640*640大小的图片
+func (e *Engine) UploadKfHeadImg(ctx context.Context, account, filename string, img io.Reader) error {
+	// https://api.weixin.qq.com/customservice/kfaccount/uploadheadimg?access_token=ACCESS_TOKEN&kf_account=KFACCOUNT
+	path := "/customservice/kfaccount/uploadheadimg?kf_account=" + url.QueryEscape(account)
+	info, err := uploadJSON[ErrorMsg](ctx, e, path, "media", filename, img, nil)
+	if err != nil {
+		return errors.WithMessage(err, "uploadJSON:")
+	}
+	if info.ErrCode != 0 {
+		return errors.WithStack(info)
+	}
+	return nil
+}
+
+type respKfList struct {
+	ErrorMsg
+	KfList []*KfInfo `json:"kf_list"`
+}
+
+// GetKfList 获取所有客服帐号
+func (e *Engine) GetKfList(ctx context.Context) ([]*KfInfo, error) {
+	// https://api.weixin.qq.com/cgi-bin/customservice/getkflist?access_token=ACCESS_TOKEN
+	info, err := getJSON[respKfList](ctx, e, "/cgi-bin/customservice/getkflist")
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.KfList, nil
+}
+
+type respKfOnlineList struct {
+	ErrorMsg
+	KfOnlineList []*KfOnlineInfo `json:"kf_online_list"`
+}
+
+// GetOnlineKfList 获取在线客服
+func (e *Engine) GetOnlineKfList(ctx context.Context) ([]*KfOnlineInfo, error) {
+	// https://api.weixin.qq.com/cgi-bin/customservice/getonlinekflist?access_token=ACCESS_TOKEN
+	info, err := getJSON[respKfOnlineList](ctx, e, "/cgi-bin/customservice/getonlinekflist")
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.KfOnlineList, nil
+}
@@ -0,0 +1,57 @@
+package weixin_api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKfAccount(t *testing.T) {
+	var bodies map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies[r.URL.Path] = string(data)
+		switch r.URL.Path {
+		case "/customservice/kfaccount/del":
+			assert.Equal(t, "test1@test", r.URL.Query().Get("kf_account"))
+		case "/cgi-bin/customservice/getkflist":
+			w.Write([]byte(`{"kf_list":[{"kf_account":"test1@test","kf_nick":"ntest1","kf_id":"1001","kf_headimgurl":"http://mmbiz.qpic.cn/mmbiz/4whpV1VZl2iccsvYbHvnphkyGtnvjfUS8Ym0GSaLic0FD3vN0V8PILcibEGb2fPfEOmw/0"}]}`))
+			return
+		case "/customservice/kfaccount/update":
+			w.Write([]byte(`{"errcode":65400,"errmsg":"please enable new custom service, or wait for a while if you have enabled"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	ctx := context.Background()
+	bodies = map[string]string{}
+
+	assert.Nil(t, e.AddKfAccount(ctx, "test1@test", "客服1"))
+	assert.JSONEq(t, `{"kf_account":"test1@test","nickname":"客服1"}`, bodies["/customservice/kfaccount/add"])
+
+	err := e.UpdateKfAccount(ctx, "test1@test", "客服2")
+	assert.JSONEq(t, `{"kf_account":"test1@test","nickname":"客服2"}`, bodies["/customservice/kfaccount/update"])
+	assert.ErrorIs(t, err, &ErrorMsg{ErrCode: 65400})
+
+	assert.Nil(t, e.InviteKfWorker(ctx, "test1@test", "test_kfwx"))
+	assert.JSONEq(t, `{"kf_account":"test1@test","invite_wx":"test_kfwx"}`, bodies["/customservice/kfaccount/inviteworker"])
+
+	assert.Nil(t, e.DeleteKfAccount(ctx, "test1@test"))
+	assert.Equal(t, "", bodies["/customservice/kfaccount/del"])
+
+	list, err := e.GetKfList(ctx)
+	assert.Nil(t, err)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "test1@test", list[0].KfAccount)
+		assert.Equal(t, "ntest1", list[0].KfNick)
+		assert.Equal(t, "1001", list[0].KfId)
+	}
+}
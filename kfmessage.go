@@ -0,0 +1,165 @@
+// 客服消息
+package weixin_api
+
+import (
+	"context"
+)
+
+// 客服消息类型
+const (
+	KfMsgTypeText            = "text"            // 文本消息
+	KfMsgTypeImage           = "image"           // 图片消息
+	KfMsgTypeVoice           = "voice"           // 语音消息
+	KfMsgTypeVideo           = "video"           // 视频消息
+	KfMsgTypeMusic           = "music"           // 音乐消息
+	KfMsgTypeNews            = "news"            // 图文消息（点击跳转到外链）
+	KfMsgTypeMpNews          = "mpnews"          // 图文消息（点击跳转到图文消息页面）
+	KfMsgTypeMpNewsArticle   = "mpnewsarticle"   // 图文消息（点击跳转到图文消息页面），使用通过发布系统发表的article_id
+	KfMsgTypeMsgMenu         = "msgmenu"         // 菜单消息
+	KfMsgTypeMiniProgramPage = "miniprogrampage" // 小程序卡片
+)
+
+type KfText struct {
+	Content string `json:"content"`
+}
+
+type KfMedia struct {
+	MediaId string `json:"media_id"`
+}
+
+type KfVideo struct {
+	MediaId      string `json:"media_id"`
+	ThumbMediaId string `json:"thumb_media_id"`
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type KfMusic struct {
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	MusicUrl     string `json:"musicurl"`
+	HQMusicUrl   string `json:"hqmusicurl"`
+	ThumbMediaId string `json:"thumb_media_id"`
+}
+
+type KfArticle struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Url         string `json:"url"`
+	PicUrl      string `json:"picurl"`
+}
+
+type KfNews struct {
+	Articles []KfArticle `json:"articles"`
+}
+
+type KfMpNewsArticle struct {
+	ArticleId string `json:"article_id"`
+}
+
+type KfMsgMenuItem struct {
+	Id      string `json:"id"`
+	Content string `json:"content"`
+}
+
+type KfMsgMenu struct {
+	HeadContent string          `json:"head_content"`
+	List        []KfMsgMenuItem `json:"list"`
+	TailContent string          `json:"tail_content"`
+}
+
+type KfMiniProgramPage struct {
+	Title        string `json:"title"`
+	AppId        string `json:"appid"`
+	PagePath     string `json:"pagepath"`
+	ThumbMediaId string `json:"thumb_media_id"`
+}
+
+type kfCustomService struct {
+	KfAccount string `json:"kf_account"`
+}
+
+// KfMessage 客服消息，通过NewKf*Message创建
+type KfMessage struct {
+	ToUser          string             `json:"touser"`
+	MsgType         string             `json:"msgtype"`
+	Text            *KfText            `json:"text,omitempty"`
+	Image           *KfMedia           `json:"image,omitempty"`
+	Voice           *KfMedia           `json:"voice,omitempty"`
+	Video           *KfVideo           `json:"video,omitempty"`
+	Music           *KfMusic           `json:"music,omitempty"`
+	News            *KfNews            `json:"news,omitempty"`
+	MpNews          *KfMedia           `json:"mpnews,omitempty"`
+	MpNewsArticle   *KfMpNewsArticle   `json:"mpnewsarticle,omitempty"`
+	MsgMenu         *KfMsgMenu         `json:"msgmenu,omitempty"`
+	MiniProgramPage *KfMiniProgramPage `json:"miniprogrampage,omitempty"`
+	CustomService   *kfCustomService   `json:"customservice,omitempty"`
+}
+
+// WithKfAccount 以指定的客服帐号发送消息
+func (m *KfMessage) WithKfAccount(account string) *KfMessage {
+	m.CustomService = &kfCustomService{KfAccount: account}
+	return m
+}
+
+func NewKfTextMessage(toUser, content string) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeText, Text: &KfText{Content: content}}
+}
+
+func NewKfImageMessage(toUser, mediaId string) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeImage, Image: &KfMedia{MediaId: mediaId}}
+}
+
+func NewKfVoiceMessage(toUser, mediaId string) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeVoice, Voice: &KfMedia{MediaId: mediaId}}
+}
+
+func NewKfVideoMessage(toUser string, video *KfVideo) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeVideo, Video: video}
+}
+
+func NewKfMusicMessage(toUser string, music *KfMusic) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeMusic, Music: music}
+}
+
+// 图文消息条数限制在1条以内
+func NewKfNewsMessage(toUser string, articles ...KfArticle) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeNews, News: &KfNews{Articles: articles}}
+}
+
+func NewKfMpNewsMessage(toUser, mediaId string) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeMpNews, MpNews: &KfMedia{MediaId: mediaId}}
+}
+
+func NewKfMpNewsArticleMessage(toUser, articleId string) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeMpNewsArticle, MpNewsArticle: &KfMpNewsArticle{ArticleId: articleId}}
+}
+
+func NewKfMsgMenuMessage(toUser string, menu *KfMsgMenu) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeMsgMenu, MsgMenu: menu}
+}
+
+func NewKfMiniProgramPageMessage(toUser string, page *KfMiniProgramPage) *KfMessage {
+	return &KfMessage{ToUser: toUser, MsgType: KfMsgTypeMiniProgramPage, MiniProgramPage: page}
+}
+
+// SendKfMessage 发送客服消息
+func (e *Engine) SendKfMessage(ctx context.Context, m *KfMessage) error {
+	// https://api.weixin.qq.com/cgi-bin/message/custom/send?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/message/custom/send", m)
+}
+
+type reqKfTyping struct {
+	ToUser  string `json:"touser"`
+	Command string `json:"command"`
+}
+
+// SetKfTyping 下发或取消"正在输入"状态
+func (e *Engine) SetKfTyping(ctx context.Context, toUser string, typing bool) error {
+	// https://api.weixin.qq.com/cgi-bin/message/custom/typing?access_token=ACCESS_TOKEN
+	req := reqKfTyping{ToUser: toUser, Command: "CancelTyping"}
+	if typing {
+		req.Command = "Typing"
+	}
+	return postJSONCheck(ctx, e, "/cgi-bin/message/custom/typing", &req)
+}
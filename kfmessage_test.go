@@ -0,0 +1,48 @@
+package weixin_api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKfMessageJSON(t *testing.T) {
+	cases := []struct {
+		msg  *KfMessage
+		want string
+	}{
+		{
+			msg:  NewKfTextMessage("OPENID", "Hello World").WithKfAccount("test1@kftest"),
+			want: `{"touser":"OPENID","msgtype":"text","text":{"content":"Hello World"},"customservice":{"kf_account":"test1@kftest"}}`,
+		},
+		{
+			msg: NewKfMsgMenuMessage("OPENID", &KfMsgMenu{
+				HeadContent: "您对本次服务是否满意呢? ",
+				List:        []KfMsgMenuItem{{Id: "101", Content: "满意"}, {Id: "102", Content: "不满意"}},
+				TailContent: "欢迎再次光临",
+			}),
+			want: `{"touser":"OPENID","msgtype":"msgmenu","msgmenu":{"head_content":"您对本次服务是否满意呢? ",
+				"list":[{"id":"101","content":"满意"},{"id":"102","content":"不满意"}],"tail_content":"欢迎再次光临"}}`,
+		},
+		{
+			msg: NewKfMiniProgramPageMessage("OPENID", &KfMiniProgramPage{
+				Title:        "title",
+				AppId:        "appid",
+				PagePath:     "pagepath",
+				ThumbMediaId: "thumb_media_id",
+			}),
+			want: `{"touser":"OPENID","msgtype":"miniprogrampage","miniprogrampage":{"title":"title","appid":"appid",
+				"pagepath":"pagepath","thumb_media_id":"thumb_media_id"}}`,
+		},
+		{
+			msg:  NewKfMpNewsArticleMessage("OPENID", "ARTICLE_ID"),
+			want: `{"touser":"OPENID","msgtype":"mpnewsarticle","mpnewsarticle":{"article_id":"ARTICLE_ID"}}`,
+		},
+	}
+	for _, c := range cases {
+		data, err := json.Marshal(c.msg)
+		assert.Nil(t, err)
+		assert.JSONEq(t, c.want, string(data))
+	}
+}
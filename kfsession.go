@@ -0,0 +1,171 @@
+// 客服会话管理
+package weixin_api
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 获取聊天记录时每次最多拉取的条数
+const MaxKfMsgRecordNumber = 10000
+
+type reqKfSession struct {
+	KfAccount string `json:"kf_account"`
+	OpenId    string `json:"openid"`
+}
+
+// CreateKfSession 创建会话，把用户openId接入到客服account
+func (e *Engine) CreateKfSession(ctx context.Context, account, openId string) error {
+	// https://api.weixin.qq.com/customservice/kfsession/create?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/customservice/kfsession/create", &reqKfSession{KfAccount: account, OpenId: openId})
+}
+
+// CloseKfSession 关闭会话
+func (e *Engine) CloseKfSession(ctx context.Context, account, openId string) error {
+	// https://api.weixin.qq.com/customservice/kfsession/close?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/customservice/kfsession/close", &reqKfSession{KfAccount: account, OpenId: openId})
+}
+
+// KfSession 客户的会话状态
+type KfSession struct {
+	ErrorMsg
+	KfAccount  string `json:"kf_account"` // 正在接待的客服，为空表示没有人在接待
+	CreateTime int64  `json:"createtime"` // 会话接入的时间
+}
+
+// GetKfSession 获取客户会话状态
+func (e *Engine) GetKfSession(ctx context.Context, openId string) (*KfSession, error) {
+	// https://api.weixin.qq.com/customservice/kfsession/getsession?access_token=ACCESS_TOKEN&openid=OPENID
+	info, err := getJSON[KfSession](ctx, e, "/customservice/kfsession/getsession?openid="+url.QueryEscape(openId))
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(info)
+	}
+	return info, nil
+}
+
+// KfSessionItem 客服的会话
+type KfSessionItem struct {
+	OpenId     string `json:"openid"`     // 客户openid
+	CreateTime int64  `json:"createtime"` // 会话接入的时间
+}
+
+type respKfSessionList struct {
+	ErrorMsg
+	SessionList []*KfSessionItem `json:"sessionlist"`
+}
+
+// GetKfSessionList 获取客服的会话列表
+func (e *Engine) GetKfSessionList(ctx context.Context, account string) ([]*KfSessionItem, error) {
+	// https://api.weixin.qq.com/customservice/kfsession/getsessionlist?access_token=ACCESS_TOKEN&kf_account=KFACCOUNT
+	info, err := getJSON[respKfSessionList](ctx, e, "/customservice/kfsession/getsessionlist?kf_account="+url.QueryEscape(account))
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.SessionList, nil
+}
+
+// KfWaitCase 未接入的会话
+type KfWaitCase struct {
+	OpenId     string `json:"openid"`      // 客户openid
+	LatestTime int64  `json:"latest_time"` // 粉丝的最后一条消息的时间
+}
+
+// KfWaitCaseList 未接入会话列表
+type KfWaitCaseList struct {
+	ErrorMsg
+	Count        int32         `json:"count"`        // 未接入会话数量
+	WaitCaseList []*KfWaitCase `json:"waitcaselist"` // 未接入会话列表，最多返回100条数据，按照来访顺序
+}
+
+// GetKfWaitCase 获取未接入会话列表
+func (e *Engine) GetKfWaitCase(ctx context.Context) (*KfWaitCaseList, error) {
+	// https://api.weixin.qq.com/customservice/kfsession/getwaitcase?access_token=ACCESS_TOKEN
+	info, err := getJSON[KfWaitCaseList](ctx, e, "/customservice/kfsession/getwaitcase")
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+// KfMsgRecord 聊天记录
+type KfMsgRecord struct {
+	OpenId   string `json:"openid"`   // 用户标识
+	OperCode int32  `json:"opercode"` // 操作码，2002（客服发送信息），2003（客服接收消息）
+	Text     string `json:"text"`     // 聊天记录
+	Time     int64  `json:"time"`     // 操作时间，unix时间戳
+	Worker   string `json:"worker"`   // 完整客服帐号
+}
+
+type reqKfMsgList struct {
+	StartTime int64 `json:"starttime"`
+	EndTime   int64 `json:"endtime"`
+	MsgId     int64 `json:"msgid"`
+	Number    int32 `json:"number"`
+}
+
+// KfMsgRecordPage 一页聊天记录，MsgId用于拉取下一页
+type KfMsgRecordPage struct {
+	ErrorMsg
+	RecordList []*KfMsgRecord `json:"recordlist"`
+	Number     int32          `json:"number"`
+	MsgId      int64          `json:"msgid"`
+}
+
+// GetKfMsgList 获取聊天记录，起始时间和结束时间必须在同一天，msgId从1开始，number不能超过10000
+func (e *Engine) GetKfMsgList(ctx context.Context, start, end time.Time, msgId int64, number int32) (*KfMsgRecordPage, error) {
+	// https://api.weixin.qq.com/customservice/msgrecord/getmsglist?access_token=ACCESS_TOKEN
+	req := reqKfMsgList{
+		StartTime: start.Unix(),
+		EndTime:   end.Unix(),
+		MsgId:     msgId,
+		Number:    number,
+	}
+	info, err := postJSON[KfMsgRecordPage](ctx, e, "/customservice/msgrecord/getmsglist", &req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+// GetAllKfMsgRecords 按页拉取时间范围内的所有聊天记录，时间范围跨天时按start所在时区的自然日拆分
+func (e *Engine) GetAllKfMsgRecords(ctx context.Context, start, end time.Time) ([]*KfMsgRecord, error) {
+	var records []*KfMsgRecord
+	for from := start; from.Before(end); {
+		// 每次拉取到当天的最后一秒，下一次从第二天零点开始
+		y, m, d := from.Date()
+		next := time.Date(y, m, d+1, 0, 0, 0, 0, from.Location())
+		to := next.Add(-time.Second)
+		if !to.Before(end) {
+			to, next = end, end
+		}
+		msgId := int64(1)
+		for {
+			page, err := e.GetKfMsgList(ctx, from, to, msgId, MaxKfMsgRecordNumber)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, page.RecordList...)
+			if page.Number < MaxKfMsgRecordNumber {
+				break
+			}
+			msgId = page.MsgId
+		}
+		from = next
+	}
+	return records, nil
+}
@@ -0,0 +1,85 @@
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKfSession(t *testing.T) {
+	var paths, bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, string(data))
+		switch r.URL.Path {
+		case "/customservice/kfsession/getsession":
+			assert.Equal(t, "OPENID", r.URL.Query().Get("openid"))
+			w.Write([]byte(`{"createtime":123456789,"errcode":0,"errmsg":"ok","kf_account":"test1@test"}`))
+			return
+		case "/customservice/kfsession/close":
+			w.Write([]byte(`{"errcode":65416,"errmsg":"invalid openid"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	ctx := context.Background()
+
+	assert.Nil(t, e.CreateKfSession(ctx, "test1@test", "OPENID"))
+	err := e.CloseKfSession(ctx, "test1@test", "OPENID")
+	assert.ErrorIs(t, err, &ErrorMsg{ErrCode: 65416})
+	session, err := e.GetKfSession(ctx, "OPENID")
+	assert.Nil(t, err)
+	assert.Equal(t, "test1@test", session.KfAccount)
+	assert.Equal(t, int64(123456789), session.CreateTime)
+
+	assert.Equal(t, []string{"/customservice/kfsession/create", "/customservice/kfsession/close", "/customservice/kfsession/getsession"}, paths)
+	assert.JSONEq(t, `{"kf_account":"test1@test","openid":"OPENID"}`, bodies[0])
+	assert.JSONEq(t, `{"kf_account":"test1@test","openid":"OPENID"}`, bodies[1])
+}
+
+func TestGetAllKfMsgRecords(t *testing.T) {
+	var reqs []reqKfMsgList
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/customservice/msgrecord/getmsglist", r.URL.Path)
+		var req reqKfMsgList
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, int32(MaxKfMsgRecordNumber), req.Number)
+		reqs = append(reqs, req)
+		page := KfMsgRecordPage{RecordList: []*KfMsgRecord{{OpenId: "OPENID", Time: req.StartTime}}, Number: 1}
+		if len(reqs) == 1 {
+			// 第一天的记录一页没有拉取完
+			page.Number = MaxKfMsgRecordNumber
+			page.MsgId = 10001
+		}
+		json.NewEncoder(w).Encode(&page)
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	loc := time.FixedZone("CST", 8*3600)
+	start := time.Date(2022, 5, 1, 22, 0, 0, 0, loc)
+	end := time.Date(2022, 5, 3, 2, 0, 0, 0, loc)
+	records, err := e.GetAllKfMsgRecords(context.Background(), start, end)
+	assert.Nil(t, err)
+	assert.Len(t, records, 4)
+
+	day2 := time.Date(2022, 5, 2, 0, 0, 0, 0, loc)
+	day3 := time.Date(2022, 5, 3, 0, 0, 0, 0, loc)
+	// 按自然日拆分，每次的起止时间都在同一天
+	assert.Equal(t, []reqKfMsgList{
+		{StartTime: start.Unix(), EndTime: day2.Unix() - 1, MsgId: 1, Number: MaxKfMsgRecordNumber},
+		{StartTime: start.Unix(), EndTime: day2.Unix() - 1, MsgId: 10001, Number: MaxKfMsgRecordNumber},
+		{StartTime: day2.Unix(), EndTime: day3.Unix() - 1, MsgId: 1, Number: MaxKfMsgRecordNumber},
+		{StartTime: day3.Unix(), EndTime: end.Unix(), MsgId: 1, Number: MaxKfMsgRecordNumber},
+	}, reqs)
+}
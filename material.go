@@ -0,0 +1,208 @@
+// 永久素材
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// 永久图文素材类型，用于BatchGetMaterial
+const MaterialTypeNews = "news"
+
+// 批量获取素材时每次最多返回的数量
+const MaxBatchGetMaterialCount = 20
+
+// Material 新增永久素材的结果
+type Material struct {
+	ErrorMsg
+	MediaId string `json:"media_id"` // 新增的永久素材的media_id
+	Url     string `json:"url"`      // 新增的图片素材的图片URL（仅新增图片素材时会返回该字段）
+}
+
+// AddMaterial 新增图片、语音、缩略图等永久素材，视频素材使用AddVideoMaterial
+func (e *Engine) AddMaterial(ctx context.Context, mediaType, filename string, r io.Reader) (*Material, error) {
+	return e.addMaterial(ctx, mediaType, filename, r, nil)
+}
+
+type videoDescription struct {
+	Title        string `json:"title"`
+	Introduction string `json:"introduction"`
+}
+
+// AddVideoMaterial 新增永久视频素材，需要额外提交视频的标题和描述
+func (e *Engine) AddVideoMaterial(ctx context.Context, filename string, r io.Reader, title, introduction string) (*Material, error) {
+	desc, err := json.Marshal(&videoDescription{Title: title, Introduction: introduction})
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+	return e.addMaterial(ctx, MediaTypeVideo, filename, r, map[string]string{"description": string(desc)})
+}
+
+func (e *Engine) addMaterial(ctx context.Context, mediaType, filename string, r io.Reader, fields map[string]string) (*Material, error) {
+	// https://api.weixin.qq.com/cgi-bin/material/add_material?access_token=ACCESS_TOKEN&type=TYPE
+	info, err := uploadJSON[Material](ctx, e, "/cgi-bin/material/add_material?type="+url.QueryEscape(mediaType), "media", filename, r, fields)
+	if err != nil {
+		return nil, errors.WithMessage(err, "uploadJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+type respUploadImg struct {
+	ErrorMsg
+	Url string `json:"url"`
+}
+
+// UploadNewsImage 上传图文消息内的图片，返回图片URL，仅支持jpg/png格式，大小必须在1MB以下
+func (e *Engine) UploadNewsImage(ctx context.Context, filename string, r io.Reader) (string, error) {
+	// https://api.weixin.qq.com/cgi-bin/media/uploadimg?access_token=ACCESS_TOKEN
+	info, err := uploadJSON[respUploadImg](ctx, e, "/cgi-bin/media/uploadimg", "media", filename, r, nil)
+	if err != nil {
+		return "", errors.WithMessage(err, "uploadJSON:")
+	}
+	if info.ErrCode != 0 {
+		return "", errors.WithStack(&info.ErrorMsg)
+	}
+	return info.Url, nil
+}
+
+// NewsItem 图文素材中的一篇文章
+type NewsItem struct {
+	Title              string `json:"title"`                 // 图文消息的标题
+	ThumbMediaId       string `json:"thumb_media_id"`        // 图文消息的封面图片素材id
+	ThumbUrl           string `json:"thumb_url"`             // 图文消息的封面图片的地址
+	ShowCoverPic       int32  `json:"show_cover_pic"`        // 是否显示封面，0为false，1为true
+	Author             string `json:"author"`                // 作者
+	Digest             string `json:"digest"`                // 图文消息的摘要
+	Content            string `json:"content"`               // 图文消息的具体内容
+	Url                string `json:"url"`                   // 图文页的URL
+	ContentSourceUrl   string `json:"content_source_url"`    // 图文消息的原文地址
+	NeedOpenComment    int32  `json:"need_open_comment"`     // 是否打开评论，0不打开，1打开
+	OnlyFansCanComment int32  `json:"only_fans_can_comment"` // 是否粉丝才可评论，0所有人可评论，1粉丝才可评论
+}
+
+// MaterialContent 获取的永久素材，图片、语音等文件内容写入writer，
+// 视频素材返回下载地址，图文素材返回文章列表
+type MaterialContent struct {
+	MediaFile
+	Title       string      `json:"title"`       // 视频素材的标题
+	Description string      `json:"description"` // 视频素材的描述
+	DownUrl     string      `json:"down_url"`    // 视频素材的下载地址
+	NewsItem    []*NewsItem `json:"news_item"`   // 图文素材的文章列表
+}
+
+type reqMediaId struct {
+	MediaId string `json:"media_id"`
+}
+
+// GetMaterial 获取永久素材，文件内容以流的方式写入w
+func (e *Engine) GetMaterial(ctx context.Context, mediaId string, w io.Writer) (*MaterialContent, error) {
+	// https://api.weixin.qq.com/cgi-bin/material/get_material?access_token=ACCESS_TOKEN
+	body, err := json.Marshal(&reqMediaId{MediaId: mediaId})
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+	file, data, err := e.downloadFile(ctx, http.MethodPost, "/cgi-bin/material/get_material", body, w)
+	if err != nil {
+		return nil, err
+	}
+	content := &MaterialContent{MediaFile: *file}
+	if data != nil {
+		if err = json.Unmarshal(data, content); err != nil {
+			return nil, errors.Wrap(err, "json.Unmarshal")
+		}
+	}
+	return content, nil
+}
+
+// DeleteMaterial 删除永久素材
+func (e *Engine) DeleteMaterial(ctx context.Context, mediaId string) error {
+	// https://api.weixin.qq.com/cgi-bin/material/del_material?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/material/del_material", &reqMediaId{MediaId: mediaId})
+}
+
+// MaterialCount 永久素材的总数
+type MaterialCount struct {
+	ErrorMsg
+	VoiceCount int32 `json:"voice_count"` // 语音总数量
+	VideoCount int32 `json:"video_count"` // 视频总数量
+	ImageCount int32 `json:"image_count"` // 图片总数量
+	NewsCount  int32 `json:"news_count"`  // 图文总数量
+}
+
+// GetMaterialCount 获取永久素材的总数
+func (e *Engine) GetMaterialCount(ctx context.Context) (*MaterialCount, error) {
+	// https://api.weixin.qq.com/cgi-bin/material/get_materialcount?access_token=ACCESS_TOKEN
+	info, err := getJSON[MaterialCount](ctx, e, "/cgi-bin/material/get_materialcount")
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+type NewsMaterialContent struct {
+	NewsItem []*NewsItem `json:"news_item"`
+}
+
+// MaterialItem 素材列表中的一项
+type MaterialItem struct {
+	MediaId    string               `json:"media_id"`
+	Name       string               `json:"name"`        // 文件名称，图文素材没有
+	UpdateTime int64                `json:"update_time"` // 这篇图文消息素材的最后更新时间
+	Url        string               `json:"url"`         // 图片素材的URL
+	Content    *NewsMaterialContent `json:"content"`     // 图文素材的内容
+}
+
+// MaterialList 一页素材列表
+type MaterialList struct {
+	ErrorMsg
+	TotalCount int32           `json:"total_count"` // 该类型的素材的总数
+	ItemCount  int32           `json:"item_count"`  // 本次调用获取的素材的数量
+	Item       []*MaterialItem `json:"item"`
+}
+
+type reqBatchGetMaterial struct {
+	Type   string `json:"type"`
+	Offset int32  `json:"offset"`
+	Count  int32  `json:"count"`
+}
+
+// BatchGetMaterial 分页获取永久素材列表，offset从0开始，count取值在1到20之间
+func (e *Engine) BatchGetMaterial(ctx context.Context, mediaType string, offset, count int32) (*MaterialList, error) {
+	// https://api.weixin.qq.com/cgi-bin/material/batchget_material?access_token=ACCESS_TOKEN
+	req := reqBatchGetMaterial{Type: mediaType, Offset: offset, Count: count}
+	info, err := postJSON[MaterialList](ctx, e, "/cgi-bin/material/batchget_material", &req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+// GetAllMaterial 按页获取某种类型的全部永久素材
+func (e *Engine) GetAllMaterial(ctx context.Context, mediaType string) ([]*MaterialItem, error) {
+	var items []*MaterialItem
+	for offset := int32(0); ; {
+		page, err := e.BatchGetMaterial(ctx, mediaType, offset, MaxBatchGetMaterialCount)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Item...)
+		offset += page.ItemCount
+		if page.ItemCount == 0 || offset >= page.TotalCount {
+			return items, nil
+		}
+	}
+}
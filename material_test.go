@@ -0,0 +1,105 @@
+package weixin_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMaterial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cgi-bin/material/get_material", r.URL.Path)
+		var req reqMediaId
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		switch req.MediaId {
+		case "IMAGE":
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Content-Disposition", `attachment; filename="IMAGE.png"`)
+			w.Write([]byte("png data"))
+		case "VIDEO":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(`{"title":"TITLE","description":"DESCRIPTION","down_url":"http://example.com/video.mp4"}`))
+		case "NEWS":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(`{"news_item":[{"title":"TITLE","thumb_media_id":"THUMB_MEDIA_ID","show_cover_pic":1,
+				"author":"AUTHOR","digest":"DIGEST","content":"CONTENT","url":"URL","content_source_url":"CONTENT_SOURCE_URL"}]}`))
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(`{"errcode":40007,"errmsg":"invalid media_id"}`))
+		}
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	ctx := context.Background()
+
+	// 图片等文件写入w
+	var buf bytes.Buffer
+	content, err := e.GetMaterial(ctx, "IMAGE", &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "IMAGE.png", content.Filename)
+	assert.Equal(t, int64(8), content.Size)
+	assert.Equal(t, "png data", buf.String())
+
+	// 视频素材返回下载地址
+	buf.Reset()
+	content, err = e.GetMaterial(ctx, "VIDEO", &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "TITLE", content.Title)
+	assert.Equal(t, "DESCRIPTION", content.Description)
+	assert.Equal(t, "http://example.com/video.mp4", content.DownUrl)
+	assert.Equal(t, 0, buf.Len())
+
+	// 图文素材返回文章列表
+	content, err = e.GetMaterial(ctx, "NEWS", &buf)
+	assert.Nil(t, err)
+	if assert.Len(t, content.NewsItem, 1) {
+		assert.Equal(t, "THUMB_MEDIA_ID", content.NewsItem[0].ThumbMediaId)
+		assert.Equal(t, int32(1), content.NewsItem[0].ShowCoverPic)
+		assert.Equal(t, "CONTENT_SOURCE_URL", content.NewsItem[0].ContentSourceUrl)
+	}
+
+	_, err = e.GetMaterial(ctx, "OTHER", &buf)
+	var msg *ErrorMsg
+	if assert.ErrorAs(t, err, &msg) {
+		assert.Equal(t, int32(40007), msg.ErrCode)
+	}
+}
+
+func TestGetAllMaterial(t *testing.T) {
+	const total = 45
+	var offsets []int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cgi-bin/material/batchget_material", r.URL.Path)
+		var req reqBatchGetMaterial
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, MediaTypeImage, req.Type)
+		assert.Equal(t, int32(MaxBatchGetMaterialCount), req.Count)
+		offsets = append(offsets, req.Offset)
+
+		list := MaterialList{TotalCount: total}
+		for i := req.Offset; i < total && i < req.Offset+req.Count; i++ {
+			list.Item = append(list.Item, &MaterialItem{MediaId: fmt.Sprintf("MEDIA_%d", i)})
+		}
+		list.ItemCount = int32(len(list.Item))
+		json.NewEncoder(w).Encode(&list)
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	items, err := e.GetAllMaterial(context.Background(), MediaTypeImage)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{0, 20, 40}, offsets)
+	if assert.Len(t, items, total) {
+		for i, item := range items {
+			assert.Equal(t, fmt.Sprintf("MEDIA_%d", i), item.MediaId)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// 临时素材
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// 素材类型
+const (
+	MediaTypeImage = "image" // 图片，10M，支持PNG\JPEG\JPG\GIF格式
+	MediaTypeVoice = "voice" // 语音，2M，播放长度不超过60s，支持AMR\MP3格式
+	MediaTypeVideo = "video" // 视频，10MB，支持MP4格式
+	MediaTypeThumb = "thumb" // 缩略图，64KB，支持JPG格式
+)
+
+// TempMedia 上传临时素材的结果，临时素材在微信后台保存3天
+type TempMedia struct {
+	ErrorMsg
+	Type         string `json:"type"`           // 媒体文件类型
+	MediaId      string `json:"media_id"`       // 媒体文件上传后，获取标识
+	ThumbMediaId string `json:"thumb_media_id"` // 缩略图上传后返回的标识
+	CreatedAt    int64  `json:"created_at"`     // 媒体文件上传时间戳
+}
+
+// UploadTempMedia 上传临时素材，文件内容以流的方式上传，
+// r实现了io.Seeker时（如*os.File），切换域名或刷新token后可以重新上传
+func (e *Engine) UploadTempMedia(ctx context.Context, mediaType, filename string, r io.Reader) (*TempMedia, error) {
+	// https://api.weixin.qq.com/cgi-bin/media/upload?access_token=ACCESS_TOKEN&type=TYPE
+	info, err := uploadJSON[TempMedia](ctx, e, "/cgi-bin/media/upload?type="+url.QueryEscape(mediaType), "media", filename, r, nil)
+	if err != nil {
+		return nil, errors.WithMessage(err, "uploadJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	if info.MediaId == "" {
+		// 缩略图只返回thumb_media_id
+		info.MediaId = info.ThumbMediaId
+	}
+	return info, nil
+}
+
+// MediaFile 下载的素材文件信息
+type MediaFile struct {
+	ContentType string // 文件类型
+	Filename    string // 微信返回的文件名
+	Size        int64  // 写入的字节数
+	VideoUrl    string // 视频素材不返回文件内容，只返回下载地址
+}
+
+type respMediaJSON struct {
+	VideoUrl string `json:"video_url"`
+}
+
+// DownloadTempMedia 下载临时素材，文件内容以流的方式写入w。
+// 视频素材只返回下载地址，不写入w。
+func (e *Engine) DownloadTempMedia(ctx context.Context, mediaId string, w io.Writer) (*MediaFile, error) {
+	// https://api.weixin.qq.com/cgi-bin/media/get?access_token=ACCESS_TOKEN&media_id=MEDIA_ID
+	return e.downloadTempMedia(ctx, "/cgi-bin/media/get?media_id="+url.QueryEscape(mediaId), w)
+}
+
+// DownloadHQVoice 下载JSSDK上传的高清语音素材，格式为speex，16K采样率
+func (e *Engine) DownloadHQVoice(ctx context.Context, mediaId string, w io.Writer) (*MediaFile, error) {
+	// https://api.weixin.qq.com/cgi-bin/media/get/jssdk?access_token=ACCESS_TOKEN&media_id=MEDIA_ID
+	return e.downloadTempMedia(ctx, "/cgi-bin/media/get/jssdk?media_id="+url.QueryEscape(mediaId), w)
+}
+
+func (e *Engine) downloadTempMedia(ctx context.Context, path string, w io.Writer) (*MediaFile, error) {
+	file, data, err := e.downloadFile(ctx, http.MethodGet, path, nil, w)
+	if err != nil || data == nil {
+		return file, err
+	}
+	var v respMediaJSON
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+	file.VideoUrl = v.VideoUrl
+	return file, nil
+}
+
+// 下载文件，回包是文件内容时写入w，回包是json时检查errcode并返回json内容
+func (e *Engine) downloadFile(ctx context.Context, method, path string, body []byte, w io.Writer) (*MediaFile, []byte, error) {
+	contentType := ""
+	if body != nil {
+		contentType = "application/json"
+	}
+	res, err := e.sendWithToken(ctx, method, path, contentType, bytesBody(body))
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "sendWithToken:")
+	}
+	defer res.Body.Close()
+
+	file := &MediaFile{ContentType: res.Header.Get("Content-Type")}
+	if !isFileResponse(res) {
+		// 出错时或视频素材返回json
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "ioutil.ReadAll")
+		}
+		var v ErrorMsg
+		if err = json.Unmarshal(data, &v); err != nil {
+			return nil, nil, errors.Wrap(err, "json.Unmarshal")
+		}
+		if v.ErrCode != 0 {
+			return nil, nil, errors.WithStack(&v)
+		}
+		return file, data, nil
+	}
+
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil {
+		file.Filename = params["filename"]
+	}
+	if file.Size, err = io.Copy(w, res.Body); err != nil {
+		return nil, nil, errors.Wrap(err, "io.Copy")
+	}
+	return file, nil, nil
+}
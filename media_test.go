@@ -0,0 +1,109 @@
+package weixin_api
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadTempMedia(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cgi-bin/token" {
+			w.Write([]byte(`{"access_token":"NEW","expires_in":7200}`))
+			return
+		}
+		attempts++
+		file, header, err := r.FormFile("media")
+		if !assert.Nil(t, err) {
+			return
+		}
+		data, _ := ioutil.ReadAll(file)
+		assert.Equal(t, "hello image", string(data))
+		assert.Equal(t, "a.jpg", header.Filename)
+		assert.Equal(t, MediaTypeThumb, r.URL.Query().Get("type"))
+		if r.URL.Query().Get("access_token") != "NEW" {
+			w.Write([]byte(`{"errcode":42001,"errmsg":"access_token expired"}`))
+			return
+		}
+		w.Write([]byte(`{"type":"thumb","thumb_media_id":"MEDIA","created_at":123}`))
+	}))
+	defer srv.Close()
+
+	repo := &testRepo{tok: "OLD", expire: time.Now().Add(time.Hour)}
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: repo})
+
+	// 支持Seek的reader在刷新token后重新上传
+	info, err := e.UploadTempMedia(context.Background(), MediaTypeThumb, "a.jpg", strings.NewReader("hello image"))
+	assert.Nil(t, err)
+	assert.Equal(t, "MEDIA", info.MediaId)
+	assert.Equal(t, 2, attempts)
+
+	// 不支持Seek的reader无法重新上传
+	repo.tok = "OLD"
+	_, err = e.UploadTempMedia(context.Background(), MediaTypeThumb, "a.jpg", ioutil.NopCloser(strings.NewReader("hello image")))
+	assert.ErrorIs(t, err, ErrBodyNotRewindable)
+}
+
+func TestDownloadTempMedia(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("media_id") {
+		case "IMAGE":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("Content-Disposition", `attachment; filename="IMAGE.jpg"`)
+			w.Write([]byte("jpeg data"))
+		case "VIDEO":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(`{"video_url":"http://example.com/video.mp4"}`))
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(`{"errcode":40007,"errmsg":"invalid media_id"}`))
+		}
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+
+	var buf bytes.Buffer
+	file, err := e.DownloadTempMedia(context.Background(), "IMAGE", &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "IMAGE.jpg", file.Filename)
+	assert.Equal(t, int64(9), file.Size)
+	assert.Equal(t, "jpeg data", buf.String())
+
+	file, err = e.DownloadTempMedia(context.Background(), "VIDEO", &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://example.com/video.mp4", file.VideoUrl)
+
+	_, err = e.DownloadTempMedia(context.Background(), "OTHER", &buf)
+	var msg *ErrorMsg
+	if assert.ErrorAs(t, err, &msg) {
+		assert.Equal(t, int32(40007), msg.ErrCode)
+	}
+}
+
+func TestAddVideoMaterial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cgi-bin/material/add_material", r.URL.Path)
+		assert.Equal(t, MediaTypeVideo, r.URL.Query().Get("type"))
+		assert.Equal(t, `{"title":"title","introduction":"intro"}`, r.FormValue("description"))
+		_, header, err := r.FormFile("media")
+		if assert.Nil(t, err) {
+			assert.Equal(t, "a.mp4", header.Filename)
+		}
+		w.Write([]byte(`{"media_id":"MEDIA"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	info, err := e.AddVideoMaterial(context.Background(), "a.mp4", strings.NewReader("video"), "title", "intro")
+	assert.Nil(t, err)
+	assert.Equal(t, "MEDIA", info.MediaId)
+}
@@ -1,39 +1,327 @@
+// 自定义菜单
 package weixin_api
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/pkg/errors"
-	"github.com/rs/zerolog/log"
 )
 
-func (e *Engine) CreateMenu(menu []byte) (*ErrorMsg, error) {
-	tok, err := e.GetAccessToken()
-	if err != nil {
-		return nil, errors.WithMessage(err, "GetAccessToken:")
+// 自定义菜单的按钮类型
+const (
+	ButtonTypeClick              = "click"                // 点击推事件
+	ButtonTypeView               = "view"                 // 跳转URL
+	ButtonTypeScanCodePush       = "scancode_push"        // 扫码推事件
+	ButtonTypeScanCodeWaitMsg    = "scancode_waitmsg"     // 扫码推事件且弹出“消息接收中”提示框
+	ButtonTypePicSysPhoto        = "pic_sysphoto"         // 弹出系统拍照发图
+	ButtonTypePicPhotoOrAlbum    = "pic_photo_or_album"   // 弹出拍照或者相册发图
+	ButtonTypePicWeixin          = "pic_weixin"           // 弹出微信相册发图器
+	ButtonTypeLocationSelect     = "location_select"      // 弹出地理位置选择器
+	ButtonTypeMediaId            = "media_id"             // 下发消息（除文本消息）
+	ButtonTypeArticleId          = "article_id"           // 下发发布后的图文消息
+	ButtonTypeArticleViewLimited = "article_view_limited" // 跳转发布后的图文消息URL
+	ButtonTypeMiniProgram        = "miniprogram"          // 跳转小程序
+)
+
+// 在公众平台官网通过网站功能发布的菜单类型，只会出现在GetCurrentSelfMenuInfo的结果中
+const (
+	SelfMenuTypeText  = "text"  // 文本消息，Value为文本内容
+	SelfMenuTypeImg   = "img"   // 图片消息，Value为mediaID
+	SelfMenuTypeVoice = "voice" // 语音消息，Value为mediaID
+	SelfMenuTypeVideo = "video" // 视频消息，Value为视频下载链接
+	SelfMenuTypeNews  = "news"  // 图文消息，Value为mediaID，图文内容在NewsInfo中
+)
+
+// 菜单接口返回的错误，可以用errors.Is判断
+var (
+	ErrMenuNotExist = &ErrorMsg{ErrCode: 46003, ErrMsg: "不存在的菜单数据"}
+)
+
+// 自定义菜单的限制
+const (
+	MaxMenuButtons        = 3    // 一级菜单最多3个
+	MaxMenuSubButtons     = 5    // 每个一级菜单最多包含5个二级菜单
+	MaxButtonNameBytes    = 16   // 一级菜单标题不超过16个字节
+	MaxSubButtonNameBytes = 60   // 子菜单标题不超过60个字节
+	MaxButtonKeyBytes     = 128  // 菜单KEY值不超过128字节
+	MaxButtonUrlBytes     = 1024 // 网页链接不超过1024字节
+)
+
+// Button 菜单按钮，带有SubButton的一级菜单不需要设置Type
+type Button struct {
+	Type      string    `json:"type,omitempty" yaml:"type,omitempty"`             // 菜单的响应动作类型
+	Name      string    `json:"name" yaml:"name"`                                 // 菜单标题
+	Key       string    `json:"key,omitempty" yaml:"key,omitempty"`               // click等点击类型必须，菜单KEY值，用于消息接口推送
+	Url       string    `json:"url,omitempty" yaml:"url,omitempty"`               // view、miniprogram类型必须，网页链接，不支持小程序的老版本客户端将打开本url
+	MediaId   string    `json:"media_id,omitempty" yaml:"media_id,omitempty"`     // media_id类型必须，永久素材的合法media_id
+	ArticleId string    `json:"article_id,omitempty" yaml:"article_id,omitempty"` // article_id、article_view_limited类型必须，发布后获得的合法article_id
+	AppId     string    `json:"appid,omitempty" yaml:"appid,omitempty"`           // miniprogram类型必须，小程序的appid
+	PagePath  string    `json:"pagepath,omitempty" yaml:"pagepath,omitempty"`     // miniprogram类型必须，小程序的页面路径
+	SubButton []*Button `json:"sub_button,omitempty" yaml:"sub_button,omitempty"` // 二级菜单
+}
+
+// Menu 自定义菜单，个性化菜单需要设置MatchRule
+type Menu struct {
+	Button    []*Button  `json:"button" yaml:"button"`
+	MatchRule *MatchRule `json:"matchrule,omitempty" yaml:"matchrule,omitempty"` // 个性化菜单的菜单匹配规则
+	MenuId    int64      `json:"menuid,omitempty" yaml:"menuid,omitempty"`       // 查询菜单时返回的菜单id
+}
+
+func ClickButton(name, key string) *Button {
+	return &Button{Type: ButtonTypeClick, Name: name, Key: key}
+}
+
+func ViewButton(name, url string) *Button {
+	return &Button{Type: ButtonTypeView, Name: name, Url: url}
+}
+
+func ScanCodePushButton(name, key string) *Button {
+	return &Button{Type: ButtonTypeScanCodePush, Name: name, Key: key}
+}
+
+func ScanCodeWaitMsgButton(name, key string) *Button {
+	return &Button{Type: ButtonTypeScanCodeWaitMsg, Name: name, Key: key}
+}
+
+func PicSysPhotoButton(name, key string) *Button {
+	return &Button{Type: ButtonTypePicSysPhoto, Name: name, Key: key}
+}
+
+func PicPhotoOrAlbumButton(name, key string) *Button {
+	return &Button{Type: ButtonTypePicPhotoOrAlbum, Name: name, Key: key}
+}
+
+func PicWeixinButton(name, key string) *Button {
+	return &Button{Type: ButtonTypePicWeixin, Name: name, Key: key}
+}
+
+func LocationSelectButton(name, key string) *Button {
+	return &Button{Type: ButtonTypeLocationSelect, Name: name, Key: key}
+}
+
+func MediaIdButton(name, mediaId string) *Button {
+	return &Button{Type: ButtonTypeMediaId, Name: name, MediaId: mediaId}
+}
+
+func ArticleIdButton(name, articleId string) *Button {
+	return &Button{Type: ButtonTypeArticleId, Name: name, ArticleId: articleId}
+}
+
+func ArticleViewLimitedButton(name, articleId string) *Button {
+	return &Button{Type: ButtonTypeArticleViewLimited, Name: name, ArticleId: articleId}
+}
+
+// MiniProgramButton 跳转小程序，url为不支持小程序的老版本客户端打开的网页
+func MiniProgramButton(name, appId, pagePath, url string) *Button {
+	return &Button{Type: ButtonTypeMiniProgram, Name: name, AppId: appId, PagePath: pagePath, Url: url}
+}
+
+// SubMenuButton 包含二级菜单的一级菜单
+func SubMenuButton(name string, subButtons ...*Button) *Button {
+	return &Button{Name: name, SubButton: subButtons}
+}
+
+// MenuBuilder 按顺序添加一级菜单，Build时校验菜单
+type MenuBuilder struct {
+	menu Menu
+}
+
+func NewMenuBuilder() *MenuBuilder {
+	return &MenuBuilder{}
+}
+
+// Add 添加一级菜单
+func (b *MenuBuilder) Add(buttons ...*Button) *MenuBuilder {
+	b.menu.Button = append(b.menu.Button, buttons...)
+	return b
+}
+
+// SubMenu 添加包含二级菜单的一级菜单
+func (b *MenuBuilder) SubMenu(name string, subButtons ...*Button) *MenuBuilder {
+	return b.Add(SubMenuButton(name, subButtons...))
+}
+
+// Build 返回校验过的菜单
+func (b *MenuBuilder) Build() (*Menu, error) {
+	menu := b.menu
+	if err := menu.Validate(); err != nil {
+		return nil, err
 	}
-	// https://api.weixin.qq.com/cgi-bin/user/info?access_token=ACCESS_TOKEN&openid=OPENID&lang=zh_CN
-	url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/menu/create?access_token=%s", tok)
+	return &menu, nil
+}
 
-	info, err := PostJSON[ErrorMsg](url, menu)
-	if err != nil {
-		return nil, errors.WithMessage(err, "HttpGet:")
+// Validate 在提交到微信之前检查菜单是否合法
+func (m *Menu) Validate() error {
+	if len(m.Button) == 0 || len(m.Button) > MaxMenuButtons {
+		return &ErrInvalidMenu{Path: "button", Reason: fmt.Sprintf("一级菜单数量必须为1到%d个", MaxMenuButtons)}
 	}
-	return info, nil
+	for i, btn := range m.Button {
+		path := fmt.Sprintf("button[%d]", i)
+		if btn == nil {
+			return &ErrInvalidMenu{Path: path, Reason: "菜单为空"}
+		}
+		if err := validateButtonName(path, btn.Name, MaxButtonNameBytes); err != nil {
+			return err
+		}
+		if btn.Type == "" && len(btn.SubButton) == 0 {
+			return &ErrInvalidMenu{Path: path, Reason: "没有设置type或sub_button"}
+		}
+		if len(btn.SubButton) == 0 {
+			if err := validateButton(path, btn); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(btn.SubButton) > MaxMenuSubButtons {
+			return &ErrInvalidMenu{Path: path + ".sub_button", Reason: fmt.Sprintf("二级菜单数量必须为1到%d个", MaxMenuSubButtons)}
+		}
+		for j, sub := range btn.SubButton {
+			subPath := fmt.Sprintf("%s.sub_button[%d]", path, j)
+			if sub == nil {
+				return &ErrInvalidMenu{Path: subPath, Reason: "菜单为空"}
+			}
+			if len(sub.SubButton) > 0 {
+				return &ErrInvalidMenu{Path: subPath, Reason: "二级菜单不能再包含子菜单"}
+			}
+			if err := validateButtonName(subPath, sub.Name, MaxSubButtonNameBytes); err != nil {
+				return err
+			}
+			if err := validateButton(subPath, sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateButtonName(path, name string, maxBytes int) error {
+	if name == "" {
+		return &ErrInvalidMenu{Path: path, Reason: "name不能为空"}
+	}
+	if len(name) > maxBytes {
+		return &ErrInvalidMenu{Path: path, Reason: fmt.Sprintf("name超过%d个字节", maxBytes)}
+	}
+	return nil
+}
+
+// 检查不同类型按钮的必填字段
+func validateButton(path string, btn *Button) error {
+	required := func(field, value string, maxBytes int) error {
+		if value == "" {
+			return &ErrInvalidMenu{Path: path, Reason: fmt.Sprintf("%s类型的菜单必须设置%s", btn.Type, field)}
+		}
+		if maxBytes > 0 && len(value) > maxBytes {
+			return &ErrInvalidMenu{Path: path, Reason: fmt.Sprintf("%s超过%d个字节", field, maxBytes)}
+		}
+		return nil
+	}
+
+	switch btn.Type {
+	case ButtonTypeClick, ButtonTypeScanCodePush, ButtonTypeScanCodeWaitMsg, ButtonTypePicSysPhoto,
+		ButtonTypePicPhotoOrAlbum, ButtonTypePicWeixin, ButtonTypeLocationSelect:
+		return required("key", btn.Key, MaxButtonKeyBytes)
+	case ButtonTypeView:
+		return required("url", btn.Url, MaxButtonUrlBytes)
+	case ButtonTypeMediaId:
+		return required("media_id", btn.MediaId, 0)
+	case ButtonTypeArticleId, ButtonTypeArticleViewLimited:
+		return required("article_id", btn.ArticleId, 0)
+	case ButtonTypeMiniProgram:
+		if err := required("url", btn.Url, MaxButtonUrlBytes); err != nil {
+			return err
+		}
+		if err := required("appid", btn.AppId, 0); err != nil {
+			return err
+		}
+		return required("pagepath", btn.PagePath, 0)
+	}
+	return &ErrInvalidMenu{Path: path, Reason: fmt.Sprintf("不支持的菜单类型%q", btn.Type)}
+}
+
+// CreateMenu 创建自定义菜单，提交前会先校验菜单
+func (e *Engine) CreateMenu(ctx context.Context, menu *Menu) error {
+	if err := menu.Validate(); err != nil {
+		return err
+	}
+	// https://api.weixin.qq.com/cgi-bin/menu/create?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/menu/create", menu)
+}
+
+// MenuInfo 通过API设置的菜单，包括默认菜单和个性化菜单
+type MenuInfo struct {
+	ErrorMsg
+	Menu            *Menu   `json:"menu"`            // 默认菜单
+	ConditionalMenu []*Menu `json:"conditionalmenu"` // 个性化菜单，按发布顺序排列
 }
 
-func (e *Engine) GetCurrentSelfMenuInfo() error {
-	tok, err := e.GetAccessToken()
+// GetMenu 查询通过API设置的菜单，没有菜单时返回ErrMenuNotExist
+func (e *Engine) GetMenu(ctx context.Context) (*MenuInfo, error) {
+	// https://api.weixin.qq.com/cgi-bin/menu/get?access_token=ACCESS_TOKEN
+	info, err := getJSON[MenuInfo](ctx, e, "/cgi-bin/menu/get")
 	if err != nil {
-		return errors.WithMessage(err, "GetAccessToken:")
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
 	}
-	// https://api.weixin.qq.com/cgi-bin/user/info?access_token=ACCESS_TOKEN&openid=OPENID&lang=zh_CN
-	url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/get_current_selfmenu_info?access_token=%s", tok)
+	return info, nil
+}
+
+// DeleteMenu 删除默认菜单及全部个性化菜单
+func (e *Engine) DeleteMenu(ctx context.Context) error {
+	// https://api.weixin.qq.com/cgi-bin/menu/delete?access_token=ACCESS_TOKEN
+	return getJSONCheck(ctx, e, "/cgi-bin/menu/delete")
+}
+
+// SelfMenuNews 官网发布的图文消息菜单中的一篇图文
+type SelfMenuNews struct {
+	Title      string `json:"title"`       // 图文消息的标题
+	Author     string `json:"author"`      // 作者
+	Digest     string `json:"digest"`      // 摘要
+	ShowCover  int32  `json:"show_cover"`  // 是否显示封面，0为不显示，1为显示
+	CoverUrl   string `json:"cover_url"`   // 封面图片的URL
+	ContentUrl string `json:"content_url"` // 正文的URL
+	SourceUrl  string `json:"source_url"`  // 原文的URL，若置空则无查看原文入口
+}
+
+// SelfMenuButton 当前使用的菜单按钮，除了API设置的字段外还包括官网发布菜单的Value和NewsInfo
+type SelfMenuButton struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Key       string `json:"key,omitempty"`
+	Url       string `json:"url,omitempty"`
+	MediaId   string `json:"media_id,omitempty"`
+	ArticleId string `json:"article_id,omitempty"`
+	AppId     string `json:"appid,omitempty"`
+	PagePath  string `json:"pagepath,omitempty"`
+	Value     string `json:"value,omitempty"` // 官网发布的菜单的内容，含义取决于Type
+	NewsInfo  *struct {
+		List []*SelfMenuNews `json:"list"`
+	} `json:"news_info,omitempty"` // 图文消息的信息
+	SubButton *struct {
+		List []*SelfMenuButton `json:"list"`
+	} `json:"sub_button,omitempty"` // 二级菜单
+}
 
-	info, err := HttpGetRaw(url)
+// SelfMenuInfo 公众号当前使用的自定义菜单
+type SelfMenuInfo struct {
+	ErrorMsg
+	IsMenuOpen   int32 `json:"is_menu_open"` // 菜单是否开启，0代表未开启，1代表开启
+	SelfMenuInfo struct {
+		Button []*SelfMenuButton `json:"button"`
+	} `json:"selfmenu_info"` // 菜单信息
+}
+
+// GetCurrentSelfMenuInfo 查询公众号当前使用的自定义菜单，包括API设置的菜单和在官网发布的菜单
+func (e *Engine) GetCurrentSelfMenuInfo(ctx context.Context) (*SelfMenuInfo, error) {
+	// https://api.weixin.qq.com/cgi-bin/get_current_selfmenu_info?access_token=ACCESS_TOKEN
+	info, err := getJSON[SelfMenuInfo](ctx, e, "/cgi-bin/get_current_selfmenu_info")
 	if err != nil {
-		return errors.WithMessage(err, "HttpGet:")
+		return nil, errors.WithMessage(err, "getJSON:")
 	}
-	log.Debug().Str("menu", string(info)).Msg("GetCurrentSelfMenuInfo")
-	return nil
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
 }
@@ -0,0 +1,134 @@
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMenuBuilder(t *testing.T) {
+	menu, err := NewMenuBuilder().
+		Add(ClickButton("今日歌曲", "V1001_TODAY_MUSIC")).
+		SubMenu("菜单",
+			ViewButton("搜索", "http://www.soso.com/"),
+			MiniProgramButton("wxa", "wx286b93c14bbf93aa", "pages/lunar/index", "http://mp.weixin.qq.com"),
+			ClickButton("赞一下我们", "V1001_GOOD"),
+		).
+		Build()
+	assert.Nil(t, err)
+
+	data, err := json.Marshal(menu)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"button":[
+		{"type":"click","name":"今日歌曲","key":"V1001_TODAY_MUSIC"},
+		{"name":"菜单","sub_button":[
+			{"type":"view","name":"搜索","url":"http://www.soso.com/"},
+			{"type":"miniprogram","name":"wxa","url":"http://mp.weixin.qq.com","appid":"wx286b93c14bbf93aa","pagepath":"pages/lunar/index"},
+			{"type":"click","name":"赞一下我们","key":"V1001_GOOD"}]}]}`, string(data))
+}
+
+func TestMenuValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		menu *Menu
+		path string
+	}{
+		{"empty", &Menu{}, "button"},
+		{"too many buttons", &Menu{Button: []*Button{
+			ClickButton("a", "a"), ClickButton("b", "b"), ClickButton("c", "c"), ClickButton("d", "d"),
+		}}, "button"},
+		{"too many sub buttons", &Menu{Button: []*Button{SubMenuButton("a",
+			ClickButton("1", "1"), ClickButton("2", "2"), ClickButton("3", "3"),
+			ClickButton("4", "4"), ClickButton("5", "5"), ClickButton("6", "6"),
+		)}}, "button[0].sub_button"},
+		{"name too long", &Menu{Button: []*Button{ClickButton("一二三四五六", "k")}}, "button[0]"},
+		{"sub name too long", &Menu{Button: []*Button{SubMenuButton("a", ClickButton(strings.Repeat("a", 61), "k"))}}, "button[0].sub_button[0]"},
+		{"missing key", &Menu{Button: []*Button{ScanCodePushButton("a", "")}}, "button[0]"},
+		{"missing url", &Menu{Button: []*Button{ViewButton("a", "")}}, "button[0]"},
+		{"missing media_id", &Menu{Button: []*Button{MediaIdButton("a", "")}}, "button[0]"},
+		{"missing pagepath", &Menu{Button: []*Button{MiniProgramButton("a", "appid", "", "http://a")}}, "button[0]"},
+		{"unknown type", &Menu{Button: []*Button{{Type: "unknown", Name: "a"}}}, "button[0]"},
+		{"nested sub button", &Menu{Button: []*Button{SubMenuButton("a", SubMenuButton("b", ClickButton("c", "c")))}}, "button[0].sub_button[0]"},
+	}
+	for _, c := range cases {
+		err := c.menu.Validate()
+		var menuErr *ErrInvalidMenu
+		if assert.ErrorAs(t, err, &menuErr, c.name) {
+			assert.Equal(t, c.path, menuErr.Path, c.name)
+		}
+	}
+
+	ok := &Menu{Button: []*Button{
+		ClickButton("一二三四五", "k"),
+		SubMenuButton("b", ArticleViewLimitedButton(strings.Repeat("a", 60), "id"), LocationSelectButton("l", "k")),
+	}}
+	assert.Nil(t, ok.Validate())
+}
+
+func TestGetMenu(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"menu":{"button":[
+			{"type":"click","name":"今日歌曲","key":"V1001_TODAY_MUSIC","sub_button":[]},
+			{"name":"菜单","sub_button":[{"type":"view","name":"搜索","url":"http://www.soso.com/","sub_button":[]}]}
+		],"menuid":208396938},
+		"conditionalmenu":[{"button":[{"type":"click","name":"今日歌曲","key":"V1001_TODAY_MUSIC","sub_button":[]}],
+			"matchrule":{"group_id":2,"sex":1,"country":"中国","province":"广东","city":"广州","client_platform_type":2},
+			"menuid":208396993}]}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	info, err := e.GetMenu(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(208396938), info.Menu.MenuId)
+	assert.Nil(t, info.Menu.Validate())
+	if assert.Len(t, info.ConditionalMenu, 1) {
+		assert.Equal(t, &MatchRule{TagId: "2", Sex: "1", Country: "中国", Province: "广东", City: "广州", ClientPlatformType: "2"},
+			info.ConditionalMenu[0].MatchRule)
+	}
+}
+
+func TestGetMenuNotExist(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errcode":46003,"errmsg":"menu no exist"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	_, err := e.GetMenu(context.Background())
+	assert.ErrorIs(t, err, ErrMenuNotExist)
+}
+
+func TestGetCurrentSelfMenuInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"is_menu_open":1,"selfmenu_info":{"button":[
+			{"type":"click","name":"今日歌曲","key":"V1001_TODAY_MUSIC"},
+			{"name":"菜单","sub_button":{"list":[
+				{"type":"view","name":"搜索","url":"http://www.soso.com/"},
+				{"type":"news","name":"图文","value":"KQb_w_Tiz","news_info":{"list":[
+					{"title":"MULTI_NEWS","author":"JIMZHENG","digest":"text","show_cover":0,"cover_url":"http://a/cover","content_url":"http://a/content","source_url":""}]}}]}},
+			{"type":"text","name":"text","value":"This is text!"}]}}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	info, err := e.GetCurrentSelfMenuInfo(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), info.IsMenuOpen)
+	buttons := info.SelfMenuInfo.Button
+	if assert.Len(t, buttons, 3) {
+		assert.Equal(t, "V1001_TODAY_MUSIC", buttons[0].Key)
+		if assert.NotNil(t, buttons[1].SubButton) && assert.Len(t, buttons[1].SubButton.List, 2) {
+			news := buttons[1].SubButton.List[1]
+			assert.Equal(t, SelfMenuTypeNews, news.Type)
+			assert.Equal(t, "MULTI_NEWS", news.NewsInfo.List[0].Title)
+		}
+		assert.Equal(t, "This is text!", buttons[2].Value)
+	}
+}
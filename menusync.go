@@ -0,0 +1,301 @@
+// 声明式的菜单同步
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// 菜单配置文件的格式
+const (
+	MenuConfigJSON = "json"
+	MenuConfigYAML = "yaml"
+)
+
+// MenuConfig 期望的菜单配置，格式和GetMenu返回的一致。
+// ConditionalMenu按发布顺序排列，越靠后的个性化菜单匹配优先级越高。
+type MenuConfig struct {
+	Menu            *Menu   `json:"menu" yaml:"menu"`                                           // 默认菜单，为空时删除全部菜单
+	ConditionalMenu []*Menu `json:"conditionalmenu,omitempty" yaml:"conditionalmenu,omitempty"` // 个性化菜单
+}
+
+// ParseMenuConfig 解析菜单配置，format为MenuConfigJSON或MenuConfigYAML
+func ParseMenuConfig(data []byte, format string) (*MenuConfig, error) {
+	var cfg MenuConfig
+	switch format {
+	case MenuConfigJSON:
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, errors.Wrap(err, "json.Unmarshal")
+		}
+	case MenuConfigYAML:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, errors.Wrap(err, "yaml.Unmarshal")
+		}
+	default:
+		return nil, errors.Errorf("不支持的菜单配置格式:%s", format)
+	}
+	return &cfg, nil
+}
+
+// LoadMenuConfig 从文件加载菜单配置，扩展名为.yaml或.yml时按YAML解析，否则按JSON解析
+func LoadMenuConfig(filename string) (*MenuConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	format := MenuConfigJSON
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		format = MenuConfigYAML
+	}
+	return ParseMenuConfig(data, format)
+}
+
+// Validate 检查默认菜单和所有个性化菜单
+func (c *MenuConfig) Validate() error {
+	if c.Menu == nil {
+		if len(c.ConditionalMenu) > 0 {
+			return &ErrInvalidMenu{Path: "menu", Reason: "创建个性化菜单之前必须先有默认菜单"}
+		}
+		return nil
+	}
+	if err := c.Menu.Validate(); err != nil {
+		return err
+	}
+	for i, menu := range c.ConditionalMenu {
+		if err := menu.Validate(); err != nil {
+			return errors.WithMessagef(err, "conditionalmenu[%d]", i)
+		}
+		if err := menu.MatchRule.Validate(); err != nil {
+			return errors.WithMessagef(err, "conditionalmenu[%d]", i)
+		}
+	}
+	return nil
+}
+
+// MenuSyncResult 菜单同步的结果
+type MenuSyncResult struct {
+	Changes []string // 人类可读的变更，每项一行，"+"为新增，"-"为删除，"~"为修改
+	Applied bool     // 变更是否已经提交到微信，dryRun或没有变更时为false
+}
+
+// Changed 期望的菜单和当前菜单是否不同
+func (r *MenuSyncResult) Changed() bool {
+	return len(r.Changes) > 0
+}
+
+func (r *MenuSyncResult) String() string {
+	if !r.Changed() {
+		return "菜单没有变化"
+	}
+	return strings.Join(r.Changes, "\n")
+}
+
+// SyncMenu 将公众号的菜单同步为desired。先通过GetMenu查询当前菜单并计算差异，只有存在差异时才提交，
+// dryRun为true时只计算差异不提交。个性化菜单只会删除和重新创建从第一处差异开始之后的部分，
+// 以保持和desired一致的匹配优先级。
+func (e *Engine) SyncMenu(ctx context.Context, desired *MenuConfig, dryRun bool) (*MenuSyncResult, error) {
+	if err := desired.Validate(); err != nil {
+		return nil, err
+	}
+	current := &MenuConfig{}
+	info, err := e.GetMenu(ctx)
+	if err != nil && !errors.Is(err, ErrMenuNotExist) {
+		return nil, errors.WithMessage(err, "GetMenu")
+	}
+	if err == nil {
+		current.Menu = info.Menu
+		current.ConditionalMenu = info.ConditionalMenu
+	}
+
+	plan := planMenuSync(current, desired)
+	result := &MenuSyncResult{Changes: plan.changes}
+	if dryRun || !result.Changed() {
+		return result, nil
+	}
+
+	if desired.Menu == nil {
+		if err := e.DeleteMenu(ctx); err != nil {
+			return result, errors.WithMessage(err, "DeleteMenu")
+		}
+		result.Applied = true
+		return result, nil
+	}
+	if plan.createMenu {
+		if err := e.CreateMenu(ctx, desired.Menu); err != nil {
+			return result, errors.WithMessage(err, "CreateMenu")
+		}
+	}
+	for _, menuId := range plan.deleteConditional {
+		if err := e.DeleteConditionalMenu(ctx, menuId); err != nil {
+			return result, errors.WithMessagef(err, "DeleteConditionalMenu %d", menuId)
+		}
+	}
+	for _, menu := range plan.addConditional {
+		if _, err := e.AddConditionalMenu(ctx, menu); err != nil {
+			return result, errors.WithMessagef(err, "AddConditionalMenu %s", describeMatchRule(menu.MatchRule))
+		}
+	}
+	result.Applied = true
+	return result, nil
+}
+
+type menuSyncPlan struct {
+	changes           []string
+	createMenu        bool
+	deleteConditional []int64
+	addConditional    []*Menu
+}
+
+func planMenuSync(current, desired *MenuConfig) *menuSyncPlan {
+	plan := &menuSyncPlan{}
+	switch {
+	case desired.Menu == nil && current.Menu == nil:
+		return plan
+	case desired.Menu == nil:
+		plan.changes = append(plan.changes, "- menu")
+		for _, menu := range current.ConditionalMenu {
+			plan.changes = append(plan.changes, "- conditionalmenu["+describeMatchRule(menu.MatchRule)+"]")
+		}
+		return plan
+	case current.Menu == nil:
+		plan.changes = append(plan.changes, "+ menu")
+		diffButtons(&plan.changes, "menu.button", nil, desired.Menu.Button)
+		plan.createMenu = true
+	default:
+		n := len(plan.changes)
+		diffButtons(&plan.changes, "menu.button", current.Menu.Button, desired.Menu.Button)
+		plan.createMenu = len(plan.changes) > n
+	}
+
+	// 相同的前缀保持不变，之后的个性化菜单全部删除后按顺序重新创建
+	same := 0
+	for same < len(current.ConditionalMenu) && same < len(desired.ConditionalMenu) &&
+		conditionalMenuEqual(current.ConditionalMenu[same], desired.ConditionalMenu[same]) {
+		same++
+	}
+	rest := current.ConditionalMenu[same:]
+	for _, menu := range rest {
+		plan.deleteConditional = append(plan.deleteConditional, menu.MenuId)
+	}
+	plan.addConditional = desired.ConditionalMenu[same:]
+
+	for _, menu := range rest {
+		if findConditionalMenu(plan.addConditional, menu.MatchRule) == nil {
+			plan.changes = append(plan.changes, "- conditionalmenu["+describeMatchRule(menu.MatchRule)+"]")
+		}
+	}
+	for _, menu := range plan.addConditional {
+		prefix := "conditionalmenu[" + describeMatchRule(menu.MatchRule) + "]"
+		old := findConditionalMenu(rest, menu.MatchRule)
+		if old == nil {
+			plan.changes = append(plan.changes, "+ "+prefix)
+			diffButtons(&plan.changes, prefix+".button", nil, menu.Button)
+			continue
+		}
+		n := len(plan.changes)
+		diffButtons(&plan.changes, prefix+".button", old.Button, menu.Button)
+		if len(plan.changes) == n {
+			plan.changes = append(plan.changes, "~ "+prefix+": 调整发布顺序")
+		}
+	}
+	return plan
+}
+
+func conditionalMenuEqual(a, b *Menu) bool {
+	if !matchRuleEqual(a.MatchRule, b.MatchRule) {
+		return false
+	}
+	var changes []string
+	diffButtons(&changes, "", a.Button, b.Button)
+	return len(changes) == 0
+}
+
+func matchRuleEqual(a, b *MatchRule) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func findConditionalMenu(menus []*Menu, rule *MatchRule) *Menu {
+	for _, menu := range menus {
+		if matchRuleEqual(menu.MatchRule, rule) {
+			return menu
+		}
+	}
+	return nil
+}
+
+func describeMatchRule(r *MatchRule) string {
+	if r == nil {
+		return ""
+	}
+	var parts []string
+	for _, f := range [][2]string{
+		{"tag_id", r.TagId},
+		{"sex", r.Sex},
+		{"country", r.Country},
+		{"province", r.Province},
+		{"city", r.City},
+		{"client_platform_type", r.ClientPlatformType},
+		{"language", r.Language},
+	} {
+		if f[1] != "" {
+			parts = append(parts, f[0]+"="+f[1])
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func buttonFields(b *Button) [][2]string {
+	return [][2]string{
+		{"type", b.Type},
+		{"name", b.Name},
+		{"key", b.Key},
+		{"url", b.Url},
+		{"media_id", b.MediaId},
+		{"article_id", b.ArticleId},
+		{"appid", b.AppId},
+		{"pagepath", b.PagePath},
+	}
+}
+
+func describeButton(b *Button) string {
+	var parts []string
+	for _, f := range buttonFields(b) {
+		if f[1] != "" {
+			parts = append(parts, fmt.Sprintf("%s=%q", f[0], f[1]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// diffButtons 按位置比较两组按钮，把差异追加到changes
+func diffButtons(changes *[]string, prefix string, cur, want []*Button) {
+	for i := 0; i < len(cur) || i < len(want); i++ {
+		path := fmt.Sprintf("%s[%d]", prefix, i)
+		switch {
+		case i >= len(cur):
+			*changes = append(*changes, "+ "+path+": "+describeButton(want[i]))
+			diffButtons(changes, path+".sub_button", nil, want[i].SubButton)
+		case i >= len(want):
+			*changes = append(*changes, "- "+path+": "+describeButton(cur[i]))
+		default:
+			curFields, wantFields := buttonFields(cur[i]), buttonFields(want[i])
+			for j := range curFields {
+				if curFields[j][1] != wantFields[j][1] {
+					*changes = append(*changes, fmt.Sprintf("~ %s.%s: %q -> %q", path, curFields[j][0], curFields[j][1], wantFields[j][1]))
+				}
+			}
+			diffButtons(changes, path+".sub_button", cur[i].SubButton, want[i].SubButton)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package weixin_api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMenuYAML = `
+menu:
+  button:
+    - type: click
+      name: 今日歌曲
+      key: V1001_TODAY_MUSIC
+    - name: 菜单
+      sub_button:
+        - type: view
+          name: 搜索
+          url: http://www.soso.com/
+conditionalmenu:
+  - button:
+      - type: click
+        name: 会员
+        key: VIP
+    matchrule:
+      tag_id: 2
+      client_platform_type: 2
+`
+
+const testCurrentMenu = `{"menu":{"button":[
+	{"type":"click","name":"今日歌曲","key":"V1001_TODAY_MUSIC","sub_button":[]},
+	{"name":"菜单","sub_button":[{"type":"view","name":"搜索","url":"http://www.soso.com/","sub_button":[]}]}
+],"menuid":100},
+"conditionalmenu":[{"button":[{"type":"click","name":"会员","key":"VIP","sub_button":[]}],
+	"matchrule":{"group_id":2,"client_platform_type":2},"menuid":101}]}`
+
+func TestParseMenuConfig(t *testing.T) {
+	cfg, err := ParseMenuConfig([]byte(testMenuYAML), MenuConfigYAML)
+	assert.Nil(t, err)
+	assert.Nil(t, cfg.Validate())
+	assert.Equal(t, "http://www.soso.com/", cfg.Menu.Button[1].SubButton[0].Url)
+	assert.Equal(t, &MatchRule{TagId: "2", ClientPlatformType: "2"}, cfg.ConditionalMenu[0].MatchRule)
+
+	_, err = ParseMenuConfig([]byte(testMenuYAML), "toml")
+	assert.Error(t, err)
+}
+
+func testMenuSyncServer(calls *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls = append(*calls, r.URL.Path)
+		switch r.URL.Path {
+		case "/cgi-bin/menu/get":
+			w.Write([]byte(testCurrentMenu))
+		case "/cgi-bin/menu/addconditional":
+			w.Write([]byte(`{"menuid":"102"}`))
+		default:
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+}
+
+func TestSyncMenuUnchanged(t *testing.T) {
+	var calls []string
+	srv := testMenuSyncServer(&calls)
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	cfg, err := ParseMenuConfig([]byte(testMenuYAML), MenuConfigYAML)
+	assert.Nil(t, err)
+	result, err := e.SyncMenu(context.Background(), cfg, false)
+	assert.Nil(t, err)
+	assert.False(t, result.Changed())
+	assert.False(t, result.Applied)
+	assert.Equal(t, []string{"/cgi-bin/menu/get"}, calls)
+}
+
+func TestSyncMenu(t *testing.T) {
+	var calls []string
+	srv := testMenuSyncServer(&calls)
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	cfg, err := ParseMenuConfig([]byte(testMenuYAML), MenuConfigYAML)
+	assert.Nil(t, err)
+	cfg.Menu.Button[0].Key = "V1002"
+	cfg.ConditionalMenu[0].Button = append(cfg.ConditionalMenu[0].Button, ViewButton("官网", "http://a"))
+	cfg.ConditionalMenu = append(cfg.ConditionalMenu, &Menu{
+		Button:    []*Button{ClickButton("iOS", "IOS")},
+		MatchRule: &MatchRule{ClientPlatformType: ClientPlatformIOS},
+	})
+
+	result, err := e.SyncMenu(context.Background(), cfg, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		`~ menu.button[0].key: "V1001_TODAY_MUSIC" -> "V1002"`,
+		`+ conditionalmenu[tag_id=2,client_platform_type=2].button[1]: type="view" name="官网" url="http://a"`,
+		`+ conditionalmenu[client_platform_type=1]`,
+		`+ conditionalmenu[client_platform_type=1].button[0]: type="click" name="iOS" key="IOS"`,
+	}, result.Changes)
+	assert.False(t, result.Applied)
+	assert.Equal(t, []string{"/cgi-bin/menu/get"}, calls)
+
+	calls = nil
+	result, err = e.SyncMenu(context.Background(), cfg, false)
+	assert.Nil(t, err)
+	assert.True(t, result.Applied)
+	assert.Equal(t, []string{
+		"/cgi-bin/menu/get",
+		"/cgi-bin/menu/create",
+		"/cgi-bin/menu/delconditional",
+		"/cgi-bin/menu/addconditional",
+		"/cgi-bin/menu/addconditional",
+	}, calls)
+}
@@ -62,3 +62,13 @@ type LinkMessage struct {
 	Description string // 消息描述
 	Url         string // 消息链接
 }
+
+// FileMessage 文件消息，文件为file
+type FileMessage struct {
+	BaseMessage
+	Title        string // 文件名
+	Description  string // 文件描述，可能为空
+	FileKey      string // 文件KEY
+	FileMd5      string // 文件MD5值
+	FileTotalLen int64  // 文件大小，单位字节
+}
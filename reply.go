@@ -0,0 +1,244 @@
+package weixin_api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 被动回复消息类型
+const (
+	ReplyTypeText  = "text"  // 回复文本消息
+	ReplyTypeImage = "image" // 回复图片消息
+	ReplyTypeVoice = "voice" // 回复语音消息
+	ReplyTypeVideo = "video" // 回复视频消息
+	ReplyTypeMusic = "music" // 回复音乐消息
+	ReplyTypeNews  = "news"  // 回复图文消息
+
+	ReplyTypeTransferCustomerService = "transfer_customer_service" // 把消息转发到客服
+)
+
+// Reply 被动回复消息，由消息处理函数返回，HandleMessage负责编码成xml
+type Reply interface {
+	// 回复的消息类型
+	ReplyType() string
+	// 写入消息类型之后的内容
+	encodeBody(w *replyWriter) error
+}
+
+// TextReply 回复文本消息
+type TextReply struct {
+	Content string // 回复的消息内容（换行：在content中能够换行，微信客户端就支持换行显示）
+}
+
+func (r *TextReply) ReplyType() string { return ReplyTypeText }
+
+func (r *TextReply) encodeBody(w *replyWriter) error {
+	return w.cdata("Content", r.Content)
+}
+
+// ImageReply 回复图片消息
+type ImageReply struct {
+	MediaId string // 通过素材管理中的接口上传多媒体文件，得到的id
+}
+
+func (r *ImageReply) ReplyType() string { return ReplyTypeImage }
+
+func (r *ImageReply) encodeBody(w *replyWriter) error {
+	return w.element("Image", func() error {
+		return w.cdata("MediaId", r.MediaId)
+	})
+}
+
+// VoiceReply 回复语音消息
+type VoiceReply struct {
+	MediaId string // 通过素材管理中的接口上传多媒体文件，得到的id
+}
+
+func (r *VoiceReply) ReplyType() string { return ReplyTypeVoice }
+
+func (r *VoiceReply) encodeBody(w *replyWriter) error {
+	return w.element("Voice", func() error {
+		return w.cdata("MediaId", r.MediaId)
+	})
+}
+
+// VideoReply 回复视频消息
+type VideoReply struct {
+	MediaId     string // 通过素材管理中的接口上传多媒体文件，得到的id
+	Title       string // 视频消息的标题，可选
+	Description string // 视频消息的描述，可选
+}
+
+func (r *VideoReply) ReplyType() string { return ReplyTypeVideo }
+
+func (r *VideoReply) encodeBody(w *replyWriter) error {
+	return w.element("Video", func() error {
+		if err := w.cdata("MediaId", r.MediaId); err != nil {
+			return err
+		}
+		if err := w.cdata("Title", r.Title); err != nil {
+			return err
+		}
+		return w.cdata("Description", r.Description)
+	})
+}
+
+// MusicReply 回复音乐消息
+type MusicReply struct {
+	Title        string // 音乐标题，可选
+	Description  string // 音乐描述，可选
+	MusicUrl     string // 音乐链接，可选
+	HQMusicUrl   string // 高质量音乐链接，WIFI环境优先使用该链接播放音乐，可选
+	ThumbMediaId string // 缩略图的媒体id，通过素材管理中的接口上传多媒体文件，得到的id
+}
+
+func (r *MusicReply) ReplyType() string { return ReplyTypeMusic }
+
+func (r *MusicReply) encodeBody(w *replyWriter) error {
+	return w.element("Music", func() error {
+		if err := w.cdata("Title", r.Title); err != nil {
+			return err
+		}
+		if err := w.cdata("Description", r.Description); err != nil {
+			return err
+		}
+		if err := w.cdata("MusicUrl", r.MusicUrl); err != nil {
+			return err
+		}
+		if err := w.cdata("HQMusicUrl", r.HQMusicUrl); err != nil {
+			return err
+		}
+		return w.cdata("ThumbMediaId", r.ThumbMediaId)
+	})
+}
+
+// Article 图文消息中的一篇文章
+type Article struct {
+	Title       string // 图文消息标题
+	Description string // 图文消息描述
+	PicUrl      string // 图片链接，支持JPG、PNG格式，较好的效果为大图360*200，小图200*200
+	Url         string // 点击图文消息跳转链接
+}
+
+// NewsReply 回复图文消息，目前只支持1条图文
+type NewsReply struct {
+	Articles []Article
+}
+
+func (r *NewsReply) ReplyType() string { return ReplyTypeNews }
+
+func (r *NewsReply) encodeBody(w *replyWriter) error {
+	if err := w.text("ArticleCount", strconv.Itoa(len(r.Articles))); err != nil {
+		return err
+	}
+	return w.element("Articles", func() error {
+		for i := range r.Articles {
+			a := &r.Articles[i]
+			err := w.element("item", func() error {
+				if err := w.cdata("Title", a.Title); err != nil {
+					return err
+				}
+				if err := w.cdata("Description", a.Description); err != nil {
+					return err
+				}
+				if err := w.cdata("PicUrl", a.PicUrl); err != nil {
+					return err
+				}
+				return w.cdata("Url", a.Url)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TransferCustomerServiceReply 把消息转发到客服，KfAccount不为空时转发给指定的客服
+type TransferCustomerServiceReply struct {
+	KfAccount string // 指定会话接入的客服账号
+}
+
+func (r *TransferCustomerServiceReply) ReplyType() string { return ReplyTypeTransferCustomerService }
+
+func (r *TransferCustomerServiceReply) encodeBody(w *replyWriter) error {
+	if r.KfAccount == "" {
+		return nil
+	}
+	return w.element("TransInfo", func() error {
+		return w.cdata("KfAccount", r.KfAccount)
+	})
+}
+
+// isNilReply r为nil，或者是nil指针，例如(*TextReply)(nil)
+func isNilReply(r Reply) bool {
+	if r == nil {
+		return true
+	}
+	v := reflect.ValueOf(r)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// EncodeReply 把回复消息编码成xml，ToUserName和FromUserName根据收到的消息自动互换
+func EncodeReply(m *BaseMessage, r Reply) ([]byte, error) {
+	if isNilReply(r) {
+		return nil, errors.New("回复消息为nil")
+	}
+	var buf bytes.Buffer
+	w := &replyWriter{enc: xml.NewEncoder(&buf)}
+	err := w.element("xml", func() error {
+		if err := w.cdata("ToUserName", m.FromUserName); err != nil {
+			return err
+		}
+		if err := w.cdata("FromUserName", m.ToUserName); err != nil {
+			return err
+		}
+		if err := w.text("CreateTime", strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+			return err
+		}
+		if err := w.cdata("MsgType", r.ReplyType()); err != nil {
+			return err
+		}
+		return r.encodeBody(w)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "EncodeReply")
+	}
+	if err = w.enc.Flush(); err != nil {
+		return nil, errors.Wrap(err, "EncodeReply")
+	}
+	return buf.Bytes(), nil
+}
+
+type cdataValue struct {
+	Value string `xml:",cdata"`
+}
+
+// 按微信要求的格式写回复消息
+type replyWriter struct {
+	enc *xml.Encoder
+}
+
+func (w *replyWriter) cdata(name, value string) error {
+	return w.enc.EncodeElement(cdataValue{Value: value}, xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+func (w *replyWriter) text(name, value string) error {
+	return w.enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+func (w *replyWriter) element(name string, fn func() error) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := w.enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return w.enc.EncodeToken(start.End())
+}
@@ -8,6 +8,7 @@ import (
 type IRepository interface {
 	GetAccessToken(ctx context.Context) (string, time.Time, error)
 	UpdateAccessToken(ctx context.Context, tok string, expiredTime time.Time) error
-	Lock() error // 上锁，并返回 true表示上锁成功
+	InvalidateAccessToken(ctx context.Context, tok string) error // 当前缓存的token等于tok时，把它标记为失效
+	Lock() error                                                 // 上锁，锁已经被其他调用方持有时返回ErrRepoLocked
 	UnLock()
 }
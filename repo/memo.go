@@ -2,22 +2,30 @@ package repo
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/billyplus/weixin_api"
-	"github.com/pkg/errors"
 )
 
 var _ weixin_api.IRepository = (*Memory)(nil)
 
 type Memory struct {
+	tokenMu            sync.RWMutex
 	accessToken        string
 	accessTokenExpired time.Time
 	mut                int32
+
+	// 推送消息去重记录
+	dedupMu    sync.Mutex
+	dedup      map[string]*dedupRecord
+	dedupSweep time.Time
 }
 
 func (memo *Memory) GetAccessToken(_ context.Context) (string, time.Time, error) {
+	memo.tokenMu.RLock()
+	defer memo.tokenMu.RUnlock()
 	if memo.accessTokenExpired.Before(time.Now()) {
 		return "", memo.accessTokenExpired, nil
 	}
@@ -25,16 +33,28 @@ func (memo *Memory) GetAccessToken(_ context.Context) (string, time.Time, error)
 }
 
 func (memo *Memory) UpdateAccessToken(_ context.Context, tok string, expiredTime time.Time) error {
+	memo.tokenMu.Lock()
+	defer memo.tokenMu.Unlock()
 	memo.accessToken = tok
 	memo.accessTokenExpired = expiredTime
 	return nil
 }
 
+func (memo *Memory) InvalidateAccessToken(_ context.Context, tok string) error {
+	memo.tokenMu.Lock()
+	defer memo.tokenMu.Unlock()
+	if memo.accessToken == tok {
+		memo.accessToken = ""
+		memo.accessTokenExpired = time.Time{}
+	}
+	return nil
+}
+
 func (memo *Memory) Lock() error {
 	if atomic.CompareAndSwapInt32(&memo.mut, 0, 1) {
 		return nil
 	}
-	return errors.New("repo is already locked")
+	return weixin_api.ErrRepoLocked
 }
 
 func (memo *Memory) UnLock() {
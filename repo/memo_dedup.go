@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/billyplus/weixin_api"
+)
+
+var _ weixin_api.IDedupStore = (*Memory)(nil)
+
+type dedupRecord struct {
+	entry  weixin_api.DedupEntry
+	expire time.Time
+}
+
+func (memo *Memory) Begin(_ context.Context, key string, ttl time.Duration) (*weixin_api.DedupEntry, error) {
+	memo.dedupMu.Lock()
+	defer memo.dedupMu.Unlock()
+
+	now := time.Now()
+	if memo.dedup == nil {
+		memo.dedup = make(map[string]*dedupRecord)
+	}
+	// 每隔ttl清理一次过期的记录
+	if now.Sub(memo.dedupSweep) > ttl {
+		for k, r := range memo.dedup {
+			if r.expire.Before(now) {
+				delete(memo.dedup, k)
+			}
+		}
+		memo.dedupSweep = now
+	}
+
+	if r, ok := memo.dedup[key]; ok && r.expire.After(now) {
+		entry := r.entry
+		return &entry, nil
+	}
+	memo.dedup[key] = &dedupRecord{expire: now.Add(ttl)}
+	return nil, nil
+}
+
+func (memo *Memory) Finish(_ context.Context, key string, reply []byte, ttl time.Duration) error {
+	memo.dedupMu.Lock()
+	defer memo.dedupMu.Unlock()
+
+	if memo.dedup == nil {
+		memo.dedup = make(map[string]*dedupRecord)
+	}
+	memo.dedup[key] = &dedupRecord{
+		entry:  weixin_api.DedupEntry{Done: true, Reply: reply},
+		expire: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (memo *Memory) Abort(_ context.Context, key string) error {
+	memo.dedupMu.Lock()
+	defer memo.dedupMu.Unlock()
+
+	delete(memo.dedup, key)
+	return nil
+}
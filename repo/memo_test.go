@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/billyplus/weixin_api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryConcurrentTokenRotation(t *testing.T) {
+	var grants int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cgi-bin/token":
+			atomic.AddInt32(&grants, 1)
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{"access_token":"NEW","expires_in":7200}`))
+		case "/cgi-bin/menu/delete":
+			if r.URL.Query().Get("access_token") != "NEW" {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+				return
+			}
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+	defer srv.Close()
+
+	memo := &Memory{}
+	assert.Nil(t, memo.UpdateAccessToken(context.Background(), "OLD", time.Now().Add(time.Hour)))
+	e := weixin_api.New(&weixin_api.WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: memo})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, e.DeleteMenu(context.Background()))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&grants))
+	tok, _, err := memo.GetAccessToken(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "NEW", tok)
+}
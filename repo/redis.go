@@ -2,8 +2,11 @@ package repo
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/billyplus/weixin_api"
@@ -61,6 +64,10 @@ type RedisCache struct {
 	keyAccessToken string
 	keyLocked      string
 	pool           *redis.Pool
+
+	// 当前持有的锁的值，解锁时只删除自己持有的锁
+	lockMu    sync.Mutex
+	lockOwner string
 }
 
 func NewRedisRepo(appId string, host string, port int, password string) *RedisCache {
@@ -167,19 +174,68 @@ func (rc *RedisCache) UpdateAccessToken(ctx context.Context, tok string, expired
 	return nil
 }
 
+// 缓存的token等于ARGV[1]时才删除，比较和删除在redis中原子执行，避免删除其他实例刚更新的token
+var invalidateTokenScript = redis.NewScript(1, `
+local data = redis.call("GET", KEYS[1])
+if data and cjson.decode(data).Tok == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (rc *RedisCache) InvalidateAccessToken(ctx context.Context, tok string) error {
+	conn := rc.pool.Get()
+	defer conn.Close()
+
+	if _, err := invalidateTokenScript.Do(conn, rc.keyAccessToken, tok); err != nil {
+		return errors.Wrap(err, "InvalidateAccessToken:")
+	}
+	return nil
+}
+
+// 锁的值等于ARGV[1]时才删除，避免锁过期后删除其他调用方持有的锁
+var unlockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Lock 上锁，锁已经被其他调用方持有时返回weixin_api.ErrRepoLocked，锁5秒后自动过期
 func (rc *RedisCache) Lock() error {
-	ctx := context.Background()
-	if err := rc.set(ctx, rc.keyLocked, 1, "NX", "PX", 5000); err != nil {
-		//log.Debug().Str("key", mut.key).Err(err).Msg("Lock")
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return errors.Wrap(err, "rand.Read")
+	}
+	owner := hex.EncodeToString(buf[:])
+
+	conn := rc.pool.Get()
+	defer conn.Close()
+	_, err := redis.String(conn.Do(cmdSet, rc.keyLocked, owner, "NX", "PX", 5000))
+	if errors.Is(err, redis.ErrNil) {
+		return weixin_api.ErrRepoLocked
+	}
+	if err != nil {
 		return errors.WithMessage(err, "failed to lock repo:")
 	}
+	rc.lockMu.Lock()
+	rc.lockOwner = owner
+	rc.lockMu.Unlock()
 	return nil
 }
 
 func (rc *RedisCache) UnLock() {
-	ctx := context.Background()
-	if err := rc.del(ctx, rc.keyLocked); err != nil {
+	rc.lockMu.Lock()
+	owner := rc.lockOwner
+	rc.lockOwner = ""
+	rc.lockMu.Unlock()
+	if owner == "" {
+		return
+	}
+
+	conn := rc.pool.Get()
+	defer conn.Close()
+	if _, err := unlockScript.Do(conn, rc.keyLocked, owner); err != nil {
 		log.Error().Str("key", rc.keyLocked).Err(err).Msg("Failed to unlock repo")
-		// return errors.WithMessage(err, "failed to unlock repo:")
 	}
 }
@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/billyplus/weixin_api"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const keyDedup = "WX_API_Dedup_%s_%s"
+
+// 去重记录的值，第一个字节表示是否处理完成，之后是回复
+const (
+	dedupPending = '0'
+	dedupDone    = '1'
+)
+
+var _ weixin_api.IDedupStore = (*RedisCache)(nil)
+
+func (rc *RedisCache) dedupKey(key string) string {
+	return fmt.Sprintf(keyDedup, rc.appId, key)
+}
+
+func (rc *RedisCache) Begin(ctx context.Context, key string, ttl time.Duration) (*weixin_api.DedupEntry, error) {
+	conn := rc.pool.Get()
+	defer conn.Close()
+
+	k := rc.dedupKey(key)
+	// 记录在SET和GET之间过期时重新尝试一次
+	for i := 0; i < 2; i++ {
+		v, err := conn.Do(cmdSet, k, []byte{dedupPending}, "NX", "PX", ttl.Milliseconds())
+		if err != nil {
+			return nil, errors.Wrap(err, "Set:")
+		}
+		if v != nil {
+			return nil, nil
+		}
+		data, err := redis.Bytes(conn.Do(cmdGet, k))
+		if errors.Is(err, redis.ErrNil) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Get:")
+		}
+		if len(data) == 0 || data[0] != dedupDone {
+			return &weixin_api.DedupEntry{}, nil
+		}
+		return &weixin_api.DedupEntry{Done: true, Reply: data[1:]}, nil
+	}
+	return &weixin_api.DedupEntry{}, nil
+}
+
+func (rc *RedisCache) Finish(ctx context.Context, key string, reply []byte, ttl time.Duration) error {
+	data := make([]byte, 0, len(reply)+1)
+	data = append(data, dedupDone)
+	data = append(data, reply...)
+	return rc.set(ctx, rc.dedupKey(key), data, "PX", ttl.Milliseconds())
+}
+
+func (rc *RedisCache) Abort(ctx context.Context, key string) error {
+	return rc.del(ctx, rc.dedupKey(key))
+}
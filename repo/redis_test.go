@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/billyplus/weixin_api"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *RedisCache, *RedisCache) {
+	s := miniredis.RunT(t)
+	port, _ := strconv.Atoi(s.Port())
+	rc1 := NewRedisRepo("wx123", s.Host(), port, "")
+	rc2 := NewRedisRepo("wx123", s.Host(), port, "")
+	t.Cleanup(func() {
+		rc1.Close()
+		rc2.Close()
+	})
+	return s, rc1, rc2
+}
+
+func TestRedisLock(t *testing.T) {
+	s, rc1, rc2 := newTestRedis(t)
+
+	assert.Nil(t, rc1.Lock())
+	assert.ErrorIs(t, rc2.Lock(), weixin_api.ErrRepoLocked)
+	// 没有持有锁时解锁不会删除其他实例的锁
+	rc2.UnLock()
+	assert.ErrorIs(t, rc2.Lock(), weixin_api.ErrRepoLocked)
+
+	rc1.UnLock()
+	assert.Nil(t, rc2.Lock())
+
+	// rc2的锁过期后被rc1拿到，rc2解锁不会删除rc1的锁
+	s.FastForward(6 * time.Second)
+	assert.Nil(t, rc1.Lock())
+	rc2.UnLock()
+	assert.ErrorIs(t, rc2.Lock(), weixin_api.ErrRepoLocked)
+	rc1.UnLock()
+	assert.False(t, s.Exists("WX_API_Repo_Locked_wx123"))
+}
+
+func TestRedisInvalidateAccessToken(t *testing.T) {
+	_, rc, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	assert.Nil(t, rc.UpdateAccessToken(ctx, "NEW", time.Now().Add(time.Hour)))
+	// 缓存的token已经被其他实例更新，不删除
+	assert.Nil(t, rc.InvalidateAccessToken(ctx, "OLD"))
+	tok, _, err := rc.GetAccessToken(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "NEW", tok)
+
+	assert.Nil(t, rc.InvalidateAccessToken(ctx, "NEW"))
+	tok, _, err = rc.GetAccessToken(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "", tok)
+}
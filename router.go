@@ -0,0 +1,170 @@
+// 消息路由
+package weixin_api
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// InboundMessage 一条待处理的推送消息
+type InboundMessage struct {
+	Context context.Context
+	MsgType string // 消息类型
+	Event   string // 事件类型，只有MsgType为event时才有
+	Data    []byte // 原始的xml
+}
+
+// MessageHandler 处理一条推送消息，没有回复时返回nil
+type MessageHandler func(m *InboundMessage) (Reply, error)
+
+// Middleware 包装MessageHandler，用来实现日志、鉴权、统计、panic恢复等通用逻辑
+type Middleware func(next MessageHandler) MessageHandler
+
+// Router 按消息类型和事件类型把消息分发给处理函数。
+// 注册处理函数和中间件需要在开始处理消息之前完成。
+type Router struct {
+	handlers    map[string]MessageHandler
+	middlewares []Middleware
+	fallback    MessageHandler
+}
+
+func NewRouter() *Router {
+	return &Router{handlers: make(map[string]MessageHandler)}
+}
+
+func routeKey(msgType, event string) string {
+	if msgType == MsgTypeEvent {
+		return msgType + ":" + event
+	}
+	return msgType
+}
+
+// Handle 注册处理函数，消息类型为event时需要指定事件类型，h为nil时取消注册
+func (r *Router) Handle(msgType, event string, h MessageHandler) {
+	key := routeKey(msgType, event)
+	if h == nil {
+		delete(r.handlers, key)
+		return
+	}
+	r.handlers[key] = h
+}
+
+// Fallback 注册默认的处理函数，没有对应处理函数的消息都交给它处理，h为nil时取消注册
+func (r *Router) Fallback(h MessageHandler) {
+	r.fallback = h
+}
+
+// Use 添加中间件，先添加的中间件在外层，所有消息都会经过中间件，包括没有处理函数的消息
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Dispatch 把消息交给对应的处理函数。没有处理函数时，内置的消息类型返回ErrInvalidHandler，
+// 其他类型返回ErrInvalidMessageType或ErrInvalidEventType。
+func (r *Router) Dispatch(m *InboundMessage) (Reply, error) {
+	h, ok := r.handlers[routeKey(m.MsgType, m.Event)]
+	if !ok {
+		h = r.fallback
+	}
+	if h == nil {
+		h = unhandledMessage
+	}
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](h)
+	}
+	return h(m)
+}
+
+func unhandledMessage(m *InboundMessage) (Reply, error) {
+	key := routeKey(m.MsgType, m.Event)
+	switch {
+	case builtinRoutes[key]:
+		return nil, ErrInvalidHandler
+	case m.MsgType == MsgTypeEvent:
+		return nil, &ErrInvalidEventType{Type: m.Event}
+	}
+	return nil, &ErrInvalidMessageType{Type: m.MsgType}
+}
+
+// 内置支持的消息和事件类型
+var builtinRoutes = map[string]bool{}
+
+func init() {
+	for _, msgType := range []string{
+		MsgTypeText, MsgTypeImage, MsgTypeVoice, MsgTypeVideo, MsgTypeShortVideo,
+		MsgTypeLocation, MsgTypeLink, MsgTypeFile,
+	} {
+		builtinRoutes[routeKey(msgType, "")] = true
+	}
+	for _, event := range []string{
+		EventTypeClick, EventTypeView, EventTypeLocation, EventTypeScan, EventTypeSubscribe, EventTypeUnsubscribe,
+		EventTypeScanCodePush, EventTypeScanCodeWaitMsg, EventTypePicSysPhoto, EventTypePicPhotoOrAlbum,
+		EventTypePicWeixin, EventTypeLocationSelect, EventTypeViewMiniProgram, EventTypeArticleViewLimited,
+		EventTypeTemplateSendJobFinish,
+	} {
+		builtinRoutes[routeKey(MsgTypeEvent, event)] = true
+	}
+}
+
+// On 注册类型安全的处理函数，消息用DecodeRawMessage[T]解码后交给fn，fn为nil时取消注册。
+// 第三方包可以用它注册自定义的事件类型，例如：
+//
+//	On(e.Router(), MsgTypeEvent, "custom_event", func(m *CustomEvent) (Reply, error) {...})
+func On[T any](r *Router, msgType, event string, fn func(m *T) (Reply, error)) {
+	if fn == nil {
+		r.Handle(msgType, event, nil)
+		return
+	}
+	r.Handle(msgType, event, func(m *InboundMessage) (Reply, error) {
+		msg, err := DecodeRawMessage[T](m.Data)
+		if err != nil {
+			return nil, errors.Wrap(err, "DecodeRawMessage")
+		}
+		return fn(msg)
+	})
+}
+
+// ErrHandlerPanic 处理函数panic时由Recovery中间件返回
+type ErrHandlerPanic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (err *ErrHandlerPanic) Error() string {
+	return fmt.Sprintf("处理消息时panic:%v", err.Value)
+}
+
+// Recovery 恢复处理函数中的panic，转换成*ErrHandlerPanic
+func Recovery() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(m *InboundMessage) (r Reply, err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					r, err = nil, &ErrHandlerPanic{Value: v, Stack: debug.Stack()}
+				}
+			}()
+			return next(m)
+		}
+	}
+}
+
+// Logger 用zerolog记录每条消息的类型、耗时和错误
+func Logger() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(m *InboundMessage) (Reply, error) {
+			start := time.Now()
+			r, err := next(m)
+			ev := log.Debug()
+			if err != nil && !isUnhandledError(err) {
+				ev = log.Warn().Err(err)
+			}
+			ev.Str("msgType", m.MsgType).Str("event", m.Event).Dur("cost", time.Since(start)).Msg("[HandleMessage]")
+			return r, err
+		}
+	}
+}
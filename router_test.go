@@ -0,0 +1,79 @@
+package weixin_api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type customEvent struct {
+	BaseEvent
+	OrderId string
+}
+
+func TestRouterCustomEvent(t *testing.T) {
+	e := New(&WeiXinApiConfig{})
+	var ev *customEvent
+	On(e.Router(), MsgTypeEvent, "order_paid", func(m *customEvent) (Reply, error) {
+		ev = m
+		return &TextReply{Content: "paid"}, nil
+	})
+
+	reply, err := e.HandleMessage(context.Background(), []byte(`<xml><ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>123456789</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[order_paid]]></Event>
+	<OrderId><![CDATA[1001]]></OrderId>
+	</xml>`))
+	assert.Nil(t, err)
+	assert.Contains(t, string(reply), "<Content><![CDATA[paid]]></Content>")
+	if assert.NotNil(t, ev) {
+		assert.Equal(t, "1001", ev.OrderId)
+	}
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(m *InboundMessage) (Reply, error) {
+				order = append(order, name+":"+m.MsgType)
+				return next(m)
+			}
+		}
+	}
+	e := New(&WeiXinApiConfig{Middlewares: []Middleware{trace("a")}})
+	e.Router().Use(Recovery(), trace("b"))
+	e.RegTextMessageHandler(func(m *TextMessage) (Reply, error) {
+		panic("boom")
+	})
+
+	_, err := e.HandleMessage(context.Background(), []byte(`<xml><MsgType><![CDATA[text]]></MsgType></xml>`))
+	var panicErr *ErrHandlerPanic
+	if assert.ErrorAs(t, err, &panicErr) {
+		assert.Equal(t, "boom", panicErr.Value)
+	}
+	assert.Equal(t, []string{"a:text", "b:text"}, order)
+
+	// 没有处理函数的消息也会经过中间件
+	order = nil
+	_, err = e.HandleMessage(context.Background(), []byte(`<xml><MsgType><![CDATA[image]]></MsgType></xml>`))
+	assert.ErrorIs(t, err, ErrInvalidHandler)
+	assert.Equal(t, []string{"a:image", "b:image"}, order)
+
+	_, err = e.HandleMessage(context.Background(), []byte(`<xml><MsgType><![CDATA[event]]></MsgType><Event><![CDATA[unknown]]></Event></xml>`))
+	var evErr *ErrInvalidEventType
+	assert.ErrorAs(t, err, &evErr)
+}
+
+func TestRouterUnregister(t *testing.T) {
+	e := New(&WeiXinApiConfig{})
+	e.RegClickEventHandler(func(m *ClickEvent) (Reply, error) {
+		return nil, nil
+	})
+	e.RegClickEventHandler(nil)
+	_, err := e.HandleMessage(context.Background(), []byte(`<xml><MsgType><![CDATA[event]]></MsgType><Event><![CDATA[CLICK]]></Event></xml>`))
+	assert.ErrorIs(t, err, ErrInvalidHandler)
+}
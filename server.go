@@ -0,0 +1,80 @@
+package weixin_api
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// 默认的回调消息体大小上限
+const defaultMaxBodySize = 1 << 20
+
+var _ http.Handler = (*Engine)(nil)
+
+// ServeHTTP 实现http.Handler，可以直接挂载为公众号的服务器回调地址。
+// GET请求用于服务器配置时的验证，POST请求为微信推送的消息。
+func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	timestamp := q.Get("timestamp")
+	nonce := q.Get("nonce")
+	if !e.ValidateSignature(timestamp, nonce, q.Get("signature")) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		io.WriteString(w, q.Get("echostr"))
+	case http.MethodPost:
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, e.maxBodySize+1))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if int64(len(data)) > e.maxBodySize {
+			http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var reply []byte
+		if q.Get("encrypt_type") == "aes" {
+			reply, err = e.HandleEncryptedMessage(r.Context(), timestamp, nonce, q.Get("msg_signature"), data)
+		} else {
+			reply, err = e.HandleMessage(r.Context(), data)
+		}
+		if err != nil {
+			e.writeHandleError(w, err)
+			return
+		}
+		if reply == nil {
+			io.WriteString(w, "success")
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Write(reply)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// 把处理消息时的错误转换成http回包
+func (e *Engine) writeHandleError(w http.ResponseWriter, err error) {
+	switch {
+	case isUnhandledError(err):
+		// 没有对应的处理函数，直接回复success，避免微信重试
+		log.Debug().Err(err).Msg("[ServeHTTP]忽略未处理的消息")
+		io.WriteString(w, "success")
+	case errors.Is(err, ErrDedupPending):
+		// 不回复success，微信会重试这条消息
+		log.Debug().Err(err).Msg("[ServeHTTP]等待第一次推送处理完成超时")
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	case errors.Is(err, ErrInvalidMsgSignature), errors.Is(err, ErrAppIdMismatch):
+		http.Error(w, "invalid message", http.StatusForbidden)
+	default:
+		log.Error().Err(err).Msg("[ServeHTTP]处理消息失败")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,64 @@
+package weixin_api
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func signedURL(tok string, extra url.Values) string {
+	q := url.Values{}
+	q.Set("timestamp", "1409304348")
+	q.Set("nonce", "nonce")
+	strs := []string{tok, "1409304348", "nonce"}
+	sort.Strings(strs)
+	q.Set("signature", fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(strs, "")))))
+	for k, v := range extra {
+		q[k] = v
+	}
+	return "/wx?" + q.Encode()
+}
+
+func TestServeHTTP(t *testing.T) {
+	e := New(&WeiXinApiConfig{AppToken: "token", MaxBodySize: 1024})
+	e.RegTextMessageHandler(func(m *TextMessage) (Reply, error) {
+		return &TextReply{Content: m.Content}, nil
+	})
+
+	// 服务器验证
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, signedURL("token", url.Values{"echostr": {"hello"}}), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+
+	// 签名错误
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, signedURL("other", url.Values{"echostr": {"hello"}}), nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 被动回复
+	body := `<xml><ToUserName><![CDATA[gh_1]]></ToUserName><FromUserName><![CDATA[openid]]></FromUserName><CreateTime>1</CreateTime><MsgType><![CDATA[text]]></MsgType><Content><![CDATA[hi]]></Content><MsgId>1</MsgId></xml>`
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, signedURL("token", nil), strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<Content><![CDATA[hi]]></Content>")
+
+	// 未注册处理函数的消息回复success
+	body = `<xml><ToUserName><![CDATA[gh_1]]></ToUserName><FromUserName><![CDATA[openid]]></FromUserName><CreateTime>1</CreateTime><MsgType><![CDATA[image]]></MsgType><MsgId>1</MsgId></xml>`
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, signedURL("token", nil), strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", w.Body.String())
+
+	// 消息体过大
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, signedURL("token", nil), strings.NewReader(strings.Repeat("a", 2048))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
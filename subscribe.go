@@ -0,0 +1,209 @@
+// 小程序订阅消息
+package weixin_api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// 跳转小程序类型，订阅消息的miniprogram_state
+const (
+	MiniProgramStateDeveloper = "developer" // 开发版
+	MiniProgramStateTrial     = "trial"     // 体验版
+	MiniProgramStateFormal    = "formal"    // 正式版
+)
+
+// 订阅消息的语言类型
+const (
+	LangZhCN = "zh_CN" // 简体中文
+	LangEnUS = "en_US" // 英文
+	LangZhHK = "zh_HK" // 繁体中文
+	LangZhTW = "zh_TW" // 繁体中文
+)
+
+// 模板类型
+const (
+	SubscribeTemplateTypeOnce = 2 // 一次性订阅
+	SubscribeTemplateTypeLong = 3 // 长期订阅
+)
+
+// SubscribeDataItem 订阅消息的一个字段，格式固定为{"value": ...}
+type SubscribeDataItem struct {
+	Value string `json:"value"`
+}
+
+// SubscribeData 订阅消息的模板内容，key为模板中的关键词，如thing1、time2
+type SubscribeData map[string]SubscribeDataItem
+
+// Set 设置关键词的值，返回自身以便链式调用
+func (d SubscribeData) Set(key, value string) SubscribeData {
+	d[key] = SubscribeDataItem{Value: value}
+	return d
+}
+
+// SubscribeMessage 订阅消息
+type SubscribeMessage struct {
+	ToUser           string        `json:"touser"`                      // 接收者（用户）的openid
+	TemplateId       string        `json:"template_id"`                 // 所需下发的订阅模板id
+	Page             string        `json:"page,omitempty"`              // 点击模板卡片后的跳转页面，仅限本小程序内的页面
+	MiniProgramState string        `json:"miniprogram_state,omitempty"` // 跳转小程序类型，默认为正式版
+	Lang             string        `json:"lang,omitempty"`              // 进入小程序查看的语言类型，默认为zh_CN
+	Data             SubscribeData `json:"data"`                        // 模板内容
+}
+
+// SendSubscribeMessage 发送订阅消息
+func (e *Engine) SendSubscribeMessage(ctx context.Context, m *SubscribeMessage) error {
+	// https://api.weixin.qq.com/cgi-bin/message/subscribe/send?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/message/subscribe/send", m)
+}
+
+// SubscribeCategory 小程序帐号的类目
+type SubscribeCategory struct {
+	Id   int32  `json:"id"`   // 类目id，查询公共库模版时需要
+	Name string `json:"name"` // 类目的中文名
+}
+
+type respSubscribeCategory struct {
+	ErrorMsg
+	Data []*SubscribeCategory `json:"data"`
+}
+
+// GetSubscribeCategory 获取小程序帐号的类目
+func (e *Engine) GetSubscribeCategory(ctx context.Context) ([]*SubscribeCategory, error) {
+	// https://api.weixin.qq.com/wxaapi/newtmpl/getcategory?access_token=ACCESS_TOKEN
+	info, err := getJSON[respSubscribeCategory](ctx, e, "/wxaapi/newtmpl/getcategory")
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.Data, nil
+}
+
+// PubTemplateTitle 公共模板库中的模板标题
+type PubTemplateTitle struct {
+	Tid        int32  `json:"tid"`        // 模版标题id
+	Title      string `json:"title"`      // 模版标题
+	Type       int32  `json:"type"`       // 模版类型，2为一次性订阅，3为长期订阅
+	CategoryId string `json:"categoryId"` // 模版所属类目id
+}
+
+// PubTemplateTitleList 公共模板标题列表
+type PubTemplateTitleList struct {
+	ErrorMsg
+	Count int32               `json:"count"` // 模版标题列表总数
+	Data  []*PubTemplateTitle `json:"data"`
+}
+
+// GetPubTemplateTitles 获取所属类目下的公共模板，start从0开始，limit最大为30
+func (e *Engine) GetPubTemplateTitles(ctx context.Context, categoryIds []int32, start, limit int32) (*PubTemplateTitleList, error) {
+	// https://api.weixin.qq.com/wxaapi/newtmpl/getpubtemplatetitles?access_token=ACCESS_TOKEN&ids=IDS&start=START&limit=LIMIT
+	ids := make([]string, len(categoryIds))
+	for i, id := range categoryIds {
+		ids[i] = fmt.Sprint(id)
+	}
+	path := fmt.Sprintf("/wxaapi/newtmpl/getpubtemplatetitles?ids=%s&start=%d&limit=%d", url.QueryEscape(strings.Join(ids, ",")), start, limit)
+	info, err := getJSON[PubTemplateTitleList](ctx, e, path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+// PubTemplateKeyword 模板标题下的关键词
+type PubTemplateKeyword struct {
+	Kid     int32  `json:"kid"`     // 关键词id，选用模板时需要
+	Name    string `json:"name"`    // 关键词内容
+	Example string `json:"example"` // 关键词内容对应的示例
+	Rule    string `json:"rule"`    // 参数类型，如thing、time
+}
+
+type respPubTemplateKeywords struct {
+	ErrorMsg
+	Count int32                 `json:"count"`
+	Data  []*PubTemplateKeyword `json:"data"`
+}
+
+// GetPubTemplateKeywords 获取模板标题下的关键词列表
+func (e *Engine) GetPubTemplateKeywords(ctx context.Context, tid int32) ([]*PubTemplateKeyword, error) {
+	// https://api.weixin.qq.com/wxaapi/newtmpl/getpubtemplatekeywords?access_token=ACCESS_TOKEN&tid=TID
+	info, err := getJSON[respPubTemplateKeywords](ctx, e, fmt.Sprintf("/wxaapi/newtmpl/getpubtemplatekeywords?tid=%d", tid))
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.Data, nil
+}
+
+type reqAddSubscribeTemplate struct {
+	Tid       string  `json:"tid"`
+	KidList   []int32 `json:"kidList"`
+	SceneDesc string  `json:"sceneDesc,omitempty"`
+}
+
+type respAddSubscribeTemplate struct {
+	ErrorMsg
+	PriTmplId string `json:"priTmplId"`
+}
+
+// AddSubscribeTemplate 从公共模板库选用模板到私有模板库，返回模板id，
+// kidList为开发者自行组合好的模板关键词列表，关键词顺序可以自由搭配，最多支持5个
+func (e *Engine) AddSubscribeTemplate(ctx context.Context, tid int32, kidList []int32, sceneDesc string) (string, error) {
+	// https://api.weixin.qq.com/wxaapi/newtmpl/addtemplate?access_token=ACCESS_TOKEN
+	req := reqAddSubscribeTemplate{Tid: fmt.Sprint(tid), KidList: kidList, SceneDesc: sceneDesc}
+	info, err := postJSON[respAddSubscribeTemplate](ctx, e, "/wxaapi/newtmpl/addtemplate", &req)
+	if err != nil {
+		return "", errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return "", errors.WithStack(&info.ErrorMsg)
+	}
+	return info.PriTmplId, nil
+}
+
+type reqDeleteSubscribeTemplate struct {
+	PriTmplId string `json:"priTmplId"`
+}
+
+// DeleteSubscribeTemplate 删除私有模板库中的模板
+func (e *Engine) DeleteSubscribeTemplate(ctx context.Context, priTmplId string) error {
+	// https://api.weixin.qq.com/wxaapi/newtmpl/deltemplate?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/wxaapi/newtmpl/deltemplate", &reqDeleteSubscribeTemplate{PriTmplId: priTmplId})
+}
+
+// SubscribeTemplate 私有模板库中的模板
+type SubscribeTemplate struct {
+	PriTmplId string `json:"priTmplId"` // 添加至帐号下的模板id，发送小程序订阅消息时所需
+	Title     string `json:"title"`     // 模版标题
+	Content   string `json:"content"`   // 模版内容
+	Example   string `json:"example"`   // 模板内容示例
+	Type      int32  `json:"type"`      // 模版类型，2为一次性订阅，3为长期订阅
+}
+
+type respSubscribeTemplateList struct {
+	ErrorMsg
+	Data []*SubscribeTemplate `json:"data"`
+}
+
+// GetSubscribeTemplateList 获取帐号下已添加的模板列表
+func (e *Engine) GetSubscribeTemplateList(ctx context.Context) ([]*SubscribeTemplate, error) {
+	// https://api.weixin.qq.com/wxaapi/newtmpl/gettemplate?access_token=ACCESS_TOKEN
+	info, err := getJSON[respSubscribeTemplateList](ctx, e, "/wxaapi/newtmpl/gettemplate")
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.Data, nil
+}
@@ -0,0 +1,61 @@
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPubTemplateTitles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/wxaapi/newtmpl/getpubtemplatetitles", r.URL.Path)
+		q := r.URL.Query()
+		assert.Equal(t, "2,616", q.Get("ids"))
+		assert.Equal(t, "0", q.Get("start"))
+		assert.Equal(t, "30", q.Get("limit"))
+		assert.Equal(t, "TOKEN", q.Get("access_token"))
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok","count":1,"data":[{"tid":99,"title":"付款成功通知","type":2,"categoryId":"616"}]}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	list, err := e.GetPubTemplateTitles(context.Background(), []int32{2, 616}, 0, 30)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), list.Count)
+	if assert.Len(t, list.Data, 1) {
+		assert.Equal(t, &PubTemplateTitle{Tid: 99, Title: "付款成功通知", Type: SubscribeTemplateTypeOnce, CategoryId: "616"}, list.Data[0])
+	}
+}
+
+func TestAddSubscribeTemplate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/wxaapi/newtmpl/addtemplate", r.URL.Path)
+		data, _ := io.ReadAll(r.Body)
+		// tid以字符串发送
+		assert.JSONEq(t, `{"tid":"401","kidList":[1,2],"sceneDesc":"测试数据"}`, string(data))
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok","priTmplId":"9Aw5ZV1j9xdWTFEkqCpZ7mIBbSC34khK55OtzUPl0rU"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	id, err := e.AddSubscribeTemplate(context.Background(), 401, []int32{1, 2}, "测试数据")
+	assert.Nil(t, err)
+	assert.Equal(t, "9Aw5ZV1j9xdWTFEkqCpZ7mIBbSC34khK55OtzUPl0rU", id)
+}
+
+func TestSubscribeData(t *testing.T) {
+	m := &SubscribeMessage{
+		ToUser:     "OPENID",
+		TemplateId: "TEMPLATE_ID",
+		Data:       SubscribeData{}.Set("thing1", "339208499").Set("time2", "2015年01月05日"),
+	}
+	data, err := json.Marshal(m)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"touser":"OPENID","template_id":"TEMPLATE_ID","data":{"thing1":{"value":"339208499"},"time2":{"value":"2015年01月05日"}}}`, string(data))
+}
@@ -0,0 +1,152 @@
+// 用户标签管理
+package weixin_api
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// 批量为用户打标签或取消标签时每次最多的用户数
+const MaxBatchTagging = 50
+
+// 标签接口返回的错误，可以用errors.Is判断
+var (
+	ErrTagNameInvalid       = &ErrorMsg{ErrCode: 45157, ErrMsg: "标签名非法，请注意不能和其他标签重名"}
+	ErrTagNameTooLong       = &ErrorMsg{ErrCode: 45158, ErrMsg: "标签名长度超过30个字节"}
+	ErrTagLimitReached      = &ErrorMsg{ErrCode: 45056, ErrMsg: "创建的标签数过多，请注意不能超过100个"}
+	ErrTagReserved          = &ErrorMsg{ErrCode: 45058, ErrMsg: "不能修改0/1/2这三个系统默认保留的标签"}
+	ErrTagTooManyFans       = &ErrorMsg{ErrCode: 45057, ErrMsg: "该标签下粉丝数超过10w，不允许直接删除"}
+	ErrUserTagLimitReached  = &ErrorMsg{ErrCode: 45059, ErrMsg: "有粉丝身上的标签数已经超过限制，即超过20个"}
+	ErrTagIdInvalid         = &ErrorMsg{ErrCode: 45159, ErrMsg: "非法的标签"}
+	ErrInvalidOpenId        = &ErrorMsg{ErrCode: 40003, ErrMsg: "传入非法的openid"}
+	ErrOpenIdNotBelongToApp = &ErrorMsg{ErrCode: 49003, ErrMsg: "传入的openid不属于此AppID"}
+	ErrTooManyOpenIds       = &ErrorMsg{ErrCode: 40032, ErrMsg: "每次传入的openid列表个数不能超过50个"}
+)
+
+// Tag 用户标签
+type Tag struct {
+	Id    int32  `json:"id"`              // 标签id，由微信分配
+	Name  string `json:"name"`            // 标签名，UTF8编码
+	Count int32  `json:"count,omitempty"` // 此标签下粉丝数
+}
+
+type reqTag struct {
+	Tag Tag `json:"tag"`
+}
+
+type respTag struct {
+	ErrorMsg
+	Tag *Tag `json:"tag"`
+}
+
+// CreateTag 创建标签，一个公众号最多可以创建100个标签
+func (e *Engine) CreateTag(ctx context.Context, name string) (*Tag, error) {
+	// https://api.weixin.qq.com/cgi-bin/tags/create?access_token=ACCESS_TOKEN
+	info, err := postJSON[respTag](ctx, e, "/cgi-bin/tags/create", &reqTag{Tag: Tag{Name: name}})
+	if err != nil {
+		return nil, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.Tag, nil
+}
+
+type respTags struct {
+	ErrorMsg
+	Tags []*Tag `json:"tags"`
+}
+
+// GetTags 获取公众号已创建的标签
+func (e *Engine) GetTags(ctx context.Context) ([]*Tag, error) {
+	// https://api.weixin.qq.com/cgi-bin/tags/get?access_token=ACCESS_TOKEN
+	info, err := getJSON[respTags](ctx, e, "/cgi-bin/tags/get")
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.Tags, nil
+}
+
+// UpdateTag 编辑标签名
+func (e *Engine) UpdateTag(ctx context.Context, id int32, name string) error {
+	// https://api.weixin.qq.com/cgi-bin/tags/update?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/tags/update", &reqTag{Tag: Tag{Id: id, Name: name}})
+}
+
+// DeleteTag 删除标签，粉丝数超过10w的标签需要先取消粉丝的标签
+func (e *Engine) DeleteTag(ctx context.Context, id int32) error {
+	// https://api.weixin.qq.com/cgi-bin/tags/delete?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/tags/delete", &reqTag{Tag: Tag{Id: id}})
+}
+
+type reqBatchTagging struct {
+	OpenIdList []string `json:"openid_list"`
+	TagId      int32    `json:"tagid"`
+}
+
+// BatchTagging 批量为用户打标签，按每批50个拆分，部分批次失败时返回*BatchError
+func (e *Engine) BatchTagging(ctx context.Context, tagId int32, openIds []string) error {
+	// https://api.weixin.qq.com/cgi-bin/tags/members/batchtagging?access_token=ACCESS_TOKEN
+	return batchOpenIds(ctx, openIds, MaxBatchTagging, func(ids []string) error {
+		return postJSONCheck(ctx, e, "/cgi-bin/tags/members/batchtagging", &reqBatchTagging{OpenIdList: ids, TagId: tagId})
+	})
+}
+
+// BatchUntagging 批量为用户取消标签，按每批50个拆分，部分批次失败时返回*BatchError
+func (e *Engine) BatchUntagging(ctx context.Context, tagId int32, openIds []string) error {
+	// https://api.weixin.qq.com/cgi-bin/tags/members/batchuntagging?access_token=ACCESS_TOKEN
+	return batchOpenIds(ctx, openIds, MaxBatchTagging, func(ids []string) error {
+		return postJSONCheck(ctx, e, "/cgi-bin/tags/members/batchuntagging", &reqBatchTagging{OpenIdList: ids, TagId: tagId})
+	})
+}
+
+type reqOpenId struct {
+	OpenId string `json:"openid"`
+}
+
+type respTagIdList struct {
+	ErrorMsg
+	TagIdList []int32 `json:"tagid_list"`
+}
+
+// GetUserTags 获取用户身上的标签列表
+func (e *Engine) GetUserTags(ctx context.Context, openId string) ([]int32, error) {
+	// https://api.weixin.qq.com/cgi-bin/tags/getidlist?access_token=ACCESS_TOKEN
+	info, err := postJSON[respTagIdList](ctx, e, "/cgi-bin/tags/getidlist", &reqOpenId{OpenId: openId})
+	if err != nil {
+		return nil, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.TagIdList, nil
+}
+
+type reqTagFollowers struct {
+	TagId      int32  `json:"tagid"`
+	NextOpenId string `json:"next_openid"`
+}
+
+// GetTagFollowers 获取标签下粉丝列表，一次最多拉取10000个，nextOpenId为空时从头开始拉取
+func (e *Engine) GetTagFollowers(ctx context.Context, tagId int32, nextOpenId string) (*OpenIdList, error) {
+	// https://api.weixin.qq.com/cgi-bin/user/tag/get?access_token=ACCESS_TOKEN
+	info, err := postJSON[OpenIdList](ctx, e, "/cgi-bin/user/tag/get", &reqTagFollowers{TagId: tagId, NextOpenId: nextOpenId})
+	if err != nil {
+		return nil, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+// TagFollowers 遍历标签下的粉丝，cursor为空时从头开始，否则从cursor之后继续
+func (e *Engine) TagFollowers(tagId int32, cursor string) *OpenIdIterator {
+	return newOpenIdIterator(cursor, func(ctx context.Context, cursor string) (*OpenIdList, error) {
+		return e.GetTagFollowers(ctx, tagId, cursor)
+	})
+}
@@ -0,0 +1,44 @@
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchTagging(t *testing.T) {
+	var batches [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req reqBatchTagging
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		batches = append(batches, req.OpenIdList)
+		if len(batches) == 2 {
+			w.Write([]byte(`{"errcode":45059,"errmsg":"has tag limit"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	var openIds []string
+	for i := 0; i < 120; i++ {
+		openIds = append(openIds, strconv.Itoa(i))
+	}
+	err := e.BatchTagging(context.Background(), 100, openIds)
+	assert.Len(t, batches, 3)
+	assert.Len(t, batches[2], 20)
+
+	var batchErr *BatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.Equal(t, openIds[50:100], batchErr.OpenIds)
+	}
+	assert.ErrorIs(t, err, ErrUserTagLimitReached)
+	assert.NotErrorIs(t, err, ErrTagLimitReached)
+}
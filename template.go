@@ -0,0 +1,153 @@
+// 模板消息
+package weixin_api
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// 模板消息发送结果，TEMPLATESENDJOBFINISH事件的Status
+const (
+	TemplateSendStatusSuccess    = "success"               // 送达成功
+	TemplateSendStatusUserBlock  = "failed:user block"     // 用户拒收
+	TemplateSendStatusSystemFail = "failed: system failed" // 其他原因失败
+)
+
+type reqSetIndustry struct {
+	IndustryId1 string `json:"industry_id1"`
+	IndustryId2 string `json:"industry_id2"`
+}
+
+// SetTemplateIndustry 设置所属行业，行业代码查询见微信文档
+func (e *Engine) SetTemplateIndustry(ctx context.Context, industryId1, industryId2 string) error {
+	// https://api.weixin.qq.com/cgi-bin/template/api_set_industry?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/template/api_set_industry", &reqSetIndustry{IndustryId1: industryId1, IndustryId2: industryId2})
+}
+
+type IndustryClass struct {
+	FirstClass  string `json:"first_class"`  // 主行业
+	SecondClass string `json:"second_class"` // 副行业
+}
+
+// TemplateIndustry 帐号设置的行业信息
+type TemplateIndustry struct {
+	ErrorMsg
+	PrimaryIndustry   IndustryClass `json:"primary_industry"`   // 帐号设置的主营行业
+	SecondaryIndustry IndustryClass `json:"secondary_industry"` // 帐号设置的副营行业
+}
+
+// GetTemplateIndustry 获取设置的行业信息
+func (e *Engine) GetTemplateIndustry(ctx context.Context) (*TemplateIndustry, error) {
+	// https://api.weixin.qq.com/cgi-bin/template/get_industry?access_token=ACCESS_TOKEN
+	info, err := getJSON[TemplateIndustry](ctx, e, "/cgi-bin/template/get_industry")
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info, nil
+}
+
+type reqAddTemplate struct {
+	TemplateIdShort string   `json:"template_id_short"`
+	KeywordNameList []string `json:"keyword_name_list,omitempty"`
+}
+
+type respAddTemplate struct {
+	ErrorMsg
+	TemplateId string `json:"template_id"`
+}
+
+// AddTemplate 从模板库添加模板，返回模板ID，keywordNames为选用的类目模板的关键词
+func (e *Engine) AddTemplate(ctx context.Context, templateIdShort string, keywordNames ...string) (string, error) {
+	// https://api.weixin.qq.com/cgi-bin/template/api_add_template?access_token=ACCESS_TOKEN
+	req := reqAddTemplate{TemplateIdShort: templateIdShort, KeywordNameList: keywordNames}
+	info, err := postJSON[respAddTemplate](ctx, e, "/cgi-bin/template/api_add_template", &req)
+	if err != nil {
+		return "", errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return "", errors.WithStack(&info.ErrorMsg)
+	}
+	return info.TemplateId, nil
+}
+
+type reqDeleteTemplate struct {
+	TemplateId string `json:"template_id"`
+}
+
+// DeleteTemplate 删除模板
+func (e *Engine) DeleteTemplate(ctx context.Context, templateId string) error {
+	// https://api.weixin.qq.com/cgi-bin/template/del_private_template?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/template/del_private_template", &reqDeleteTemplate{TemplateId: templateId})
+}
+
+// TemplateInfo 已添加的模板
+type TemplateInfo struct {
+	TemplateId      string `json:"template_id"`      // 模板ID
+	Title           string `json:"title"`            // 模板标题
+	PrimaryIndustry string `json:"primary_industry"` // 模板所属行业的一级行业
+	DeputyIndustry  string `json:"deputy_industry"`  // 模板所属行业的二级行业
+	Content         string `json:"content"`          // 模板内容
+	Example         string `json:"example"`          // 模板示例
+}
+
+type respTemplateList struct {
+	ErrorMsg
+	TemplateList []*TemplateInfo `json:"template_list"`
+}
+
+// GetAllPrivateTemplate 获取已添加至帐号下所有模板列表
+func (e *Engine) GetAllPrivateTemplate(ctx context.Context) ([]*TemplateInfo, error) {
+	// https://api.weixin.qq.com/cgi-bin/template/get_all_private_template?access_token=ACCESS_TOKEN
+	info, err := getJSON[respTemplateList](ctx, e, "/cgi-bin/template/get_all_private_template")
+	if err != nil {
+		return nil, errors.WithMessage(err, "getJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.TemplateList, nil
+}
+
+// TemplateDataItem 模板数据，Color为空时使用默认颜色
+type TemplateDataItem struct {
+	Value string `json:"value"`
+	Color string `json:"color,omitempty"`
+}
+
+// TemplateMiniProgram 点击模板消息跳转的小程序
+type TemplateMiniProgram struct {
+	AppId    string `json:"appid"`              // 所需跳转到的小程序appid（该小程序appid必须与发模板消息的公众号是绑定关联关系，暂不支持小游戏）
+	PagePath string `json:"pagepath,omitempty"` // 所需跳转到小程序的具体页面路径，支持带参数
+}
+
+// TemplateMessage 模板消息，Url和MiniProgram都设置时优先跳转小程序
+type TemplateMessage struct {
+	ToUser      string                      `json:"touser"`
+	TemplateId  string                      `json:"template_id"`
+	Url         string                      `json:"url,omitempty"`
+	MiniProgram *TemplateMiniProgram        `json:"miniprogram,omitempty"`
+	ClientMsgId string                      `json:"client_msg_id,omitempty"` // 防重入id，同一个client_msg_id只会发送一次
+	Data        map[string]TemplateDataItem `json:"data"`
+}
+
+type respSendTemplate struct {
+	ErrorMsg
+	MsgId int64 `json:"msgid"`
+}
+
+// SendTemplateMessage 发送模板消息，返回消息id，发送结果通过TEMPLATESENDJOBFINISH事件推送
+func (e *Engine) SendTemplateMessage(ctx context.Context, m *TemplateMessage) (int64, error) {
+	// https://api.weixin.qq.com/cgi-bin/message/template/send?access_token=ACCESS_TOKEN
+	info, err := postJSON[respSendTemplate](ctx, e, "/cgi-bin/message/template/send", m)
+	if err != nil {
+		return 0, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return 0, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.MsgId, nil
+}
@@ -0,0 +1,88 @@
+package weixin_api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendTemplateMessage(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cgi-bin/message/template/send", r.URL.Path)
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok","msgid":200228332}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	msgId, err := e.SendTemplateMessage(context.Background(), &TemplateMessage{
+		ToUser:      "OPENID",
+		TemplateId:  "ngqIpbwh8bUfcSsECmogfXcV14J0tQlEpBO27izEYtY",
+		Url:         "http://weixin.qq.com/download",
+		MiniProgram: &TemplateMiniProgram{AppId: "xiaochengxuappid12345", PagePath: "index?foo=bar"},
+		Data: map[string]TemplateDataItem{
+			"keyword1": {Value: "巧克力", Color: "#173177"},
+			"keyword2": {Value: "39.8元"},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(200228332), msgId)
+	assert.JSONEq(t, `{"touser":"OPENID","template_id":"ngqIpbwh8bUfcSsECmogfXcV14J0tQlEpBO27izEYtY",
+		"url":"http://weixin.qq.com/download",
+		"miniprogram":{"appid":"xiaochengxuappid12345","pagepath":"index?foo=bar"},
+		"data":{"keyword1":{"value":"巧克力","color":"#173177"},"keyword2":{"value":"39.8元"}}}`, body)
+}
+
+func TestTemplateManagement(t *testing.T) {
+	bodies := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies[r.URL.Path] = string(data)
+		switch r.URL.Path {
+		case "/cgi-bin/template/api_add_template":
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok","template_id":"Doclyl5uP7Aciu-qZ7mJNPtWkbkYnWBWVja26EGbNyk"}`))
+		case "/cgi-bin/template/get_all_private_template":
+			w.Write([]byte(`{"template_list":[{"template_id":"iPk5sOIt5X_flOVKn5GrTFpncEYTojx6ddbt8WYoV5s",
+				"title":"领取奖金提醒","primary_industry":"IT科技","deputy_industry":"互联网|电子商务",
+				"content":"{ {result.DATA} }\n\n领奖金额:{ {withdrawMoney.DATA} }\n","example":"您已提交领奖申请\n\n领奖金额：xxxx元\n"}]}`))
+		case "/cgi-bin/template/del_private_template":
+			w.Write([]byte(`{"errcode":40037,"errmsg":"invalid template_id"}`))
+		default:
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	ctx := context.Background()
+
+	assert.Nil(t, e.SetTemplateIndustry(ctx, "1", "4"))
+	assert.JSONEq(t, `{"industry_id1":"1","industry_id2":"4"}`, bodies["/cgi-bin/template/api_set_industry"])
+
+	id, err := e.AddTemplate(ctx, "TM00015", "商品名称", "购买时间")
+	assert.Nil(t, err)
+	assert.Equal(t, "Doclyl5uP7Aciu-qZ7mJNPtWkbkYnWBWVja26EGbNyk", id)
+	assert.JSONEq(t, `{"template_id_short":"TM00015","keyword_name_list":["商品名称","购买时间"]}`, bodies["/cgi-bin/template/api_add_template"])
+
+	list, err := e.GetAllPrivateTemplate(ctx)
+	assert.Nil(t, err)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "iPk5sOIt5X_flOVKn5GrTFpncEYTojx6ddbt8WYoV5s", list[0].TemplateId)
+		assert.Equal(t, "互联网|电子商务", list[0].DeputyIndustry)
+	}
+
+	err = e.DeleteTemplate(ctx, "Dyvp3-Ff0cnail_CDSzk1fIc6-9lOkxsQE7exTJbwUE")
+	assert.JSONEq(t, `{"template_id":"Dyvp3-Ff0cnail_CDSzk1fIc6-9lOkxsQE7exTJbwUE"}`, bodies["/cgi-bin/template/del_private_template"])
+	var msg *ErrorMsg
+	if assert.ErrorAs(t, err, &msg) {
+		assert.Equal(t, int32(40037), msg.ErrCode)
+		assert.Equal(t, "invalid template_id", msg.ErrMsg)
+	}
+}
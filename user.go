@@ -2,25 +2,169 @@
 package weixin_api
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"sync"
 
 	"github.com/pkg/errors"
 )
 
+// 批量获取用户信息时每次最多拉取的用户数
+const MaxBatchGetUserInfo = 100
+
+// 批量获取用户信息时默认的并发数
+const DefaultBatchGetConcurrency = 4
+
+// 用户关注的渠道来源，UserInfo的SubscribeScene
+const (
+	SubscribeSceneSearch              = "ADD_SCENE_SEARCH"               // 公众号搜索
+	SubscribeSceneAccountMigration    = "ADD_SCENE_ACCOUNT_MIGRATION"    // 公众号迁移
+	SubscribeSceneProfileCard         = "ADD_SCENE_PROFILE_CARD"         // 名片分享
+	SubscribeSceneQRCode              = "ADD_SCENE_QR_CODE"              // 扫描二维码
+	SubscribeSceneProfileLink         = "ADD_SCENE_PROFILE_LINK"         // 图文页内名称点击
+	SubscribeSceneProfileItem         = "ADD_SCENE_PROFILE_ITEM"         // 图文页右上角菜单
+	SubscribeScenePaid                = "ADD_SCENE_PAID"                 // 支付后关注
+	SubscribeSceneWechatAdvertisement = "ADD_SCENE_WECHAT_ADVERTISEMENT" // 微信广告
+	SubscribeSceneReprint             = "ADD_SCENE_REPRINT"              // 他人转载
+	SubscribeSceneLivestream          = "ADD_SCENE_LIVESTREAM"           // 视频号直播
+	SubscribeSceneChannels            = "ADD_SCENE_CHANNELS"             // 视频号
+	SubscribeSceneOthers              = "ADD_SCENE_OTHERS"               // 其他
+)
+
+// UserInfo 用户基本信息
 type UserInfo struct {
+	Subscribe      int32   `json:"subscribe"`       // 用户是否订阅该公众号标识，值为0时，代表此用户没有关注该公众号，拉取不到其余信息
+	OpenId         string  `json:"openid"`          // 用户的标识，对当前公众号唯一
+	Language       string  `json:"language"`        // 用户的语言，简体中文为zh_CN
+	SubscribeTime  int64   `json:"subscribe_time"`  // 用户关注时间，为时间戳。如果用户曾多次关注，则取最后关注时间
+	UnionId        string  `json:"unionid"`         // 只有在用户将公众号绑定到微信开放平台帐号后，才会出现该字段
+	Remark         string  `json:"remark"`          // 公众号运营者对粉丝的备注
+	GroupId        int32   `json:"groupid"`         // 用户所在的分组ID（兼容旧的用户分组接口）
+	TagIdList      []int32 `json:"tagid_list"`      // 用户被打上的标签ID列表
+	SubscribeScene string  `json:"subscribe_scene"` // 用户关注的渠道来源
+	QrScene        int64   `json:"qr_scene"`        // 二维码扫码场景
+	QrSceneStr     string  `json:"qr_scene_str"`    // 二维码扫码场景描述
 }
 
-func (e *Engine) GetUserInfo() (*UserInfo, error) {
-	tok, err := e.GetAccessToken()
+type respUserInfo struct {
+	ErrorMsg
+	UserInfo
+}
+
+// GetUserInfo 获取用户基本信息，lang为空时使用zh_CN
+func (e *Engine) GetUserInfo(ctx context.Context, openId, lang string) (*UserInfo, error) {
+	// https://api.weixin.qq.com/cgi-bin/user/info?access_token=ACCESS_TOKEN&openid=OPENID&lang=zh_CN
+	if lang == "" {
+		lang = LangZhCN
+	}
+	path := fmt.Sprintf("/cgi-bin/user/info?openid=%s&lang=%s", url.QueryEscape(openId), url.QueryEscape(lang))
+	info, err := getJSON[respUserInfo](ctx, e, path)
 	if err != nil {
-		return nil, errors.WithMessage(err, "GetAccessToken:")
+		return nil, errors.WithMessage(err, "getJSON:")
 	}
-	// https://api.weixin.qq.com/cgi-bin/user/info?access_token=ACCESS_TOKEN&openid=OPENID&lang=zh_CN
-	url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/user/info?access_token=%s&openid=OPENID&lang=zh_CN", tok)
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return &info.UserInfo, nil
+}
+
+type userListItem struct {
+	OpenId string `json:"openid"`
+	Lang   string `json:"lang,omitempty"`
+}
+
+type reqBatchGetUserInfo struct {
+	UserList []userListItem `json:"user_list"`
+}
+
+type respBatchGetUserInfo struct {
+	ErrorMsg
+	UserInfoList []*UserInfo `json:"user_info_list"`
+}
 
-	info, err := HttpGet[UserInfo](url)
+// batchGetUserInfo 批量获取用户基本信息，最多支持一次拉取100条
+func (e *Engine) batchGetUserInfo(ctx context.Context, openIds []string, lang string) ([]*UserInfo, error) {
+	// https://api.weixin.qq.com/cgi-bin/user/info/batchget?access_token=ACCESS_TOKEN
+	req := reqBatchGetUserInfo{UserList: make([]userListItem, len(openIds))}
+	for i, openId := range openIds {
+		req.UserList[i] = userListItem{OpenId: openId, Lang: lang}
+	}
+	info, err := postJSON[respBatchGetUserInfo](ctx, e, "/cgi-bin/user/info/batchget", &req)
 	if err != nil {
-		return nil, errors.WithMessage(err, "HttpGet:")
+		return nil, errors.WithMessage(err, "postJSON:")
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.WithStack(&info.ErrorMsg)
+	}
+	return info.UserInfoList, nil
+}
+
+// BatchGetUserInfo 批量获取用户基本信息，按每批100个拆分后并发拉取，返回结果与openIds顺序一致。
+// concurrency不大于0时使用DefaultBatchGetConcurrency，任意一批失败时返回错误。
+func (e *Engine) BatchGetUserInfo(ctx context.Context, openIds []string, lang string, concurrency int) ([]*UserInfo, error) {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchGetConcurrency
+	}
+	batches := (len(openIds) + MaxBatchGetUserInfo - 1) / MaxBatchGetUserInfo
+	results := make([][]*UserInfo, batches)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < batches; i++ {
+		start := i * MaxBatchGetUserInfo
+		end := start + MaxBatchGetUserInfo
+		if end > len(openIds) {
+			end = len(openIds)
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, ids []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			list, err := e.batchGetUserInfo(ctx, ids, lang)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = list
+		}(i, openIds[start:end])
 	}
-	return info, nil
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	users := make([]*UserInfo, 0, len(openIds))
+	for _, list := range results {
+		users = append(users, list...)
+	}
+	return users, nil
+}
+
+type reqUpdateRemark struct {
+	OpenId string `json:"openid"`
+	Remark string `json:"remark"`
+}
+
+// UpdateUserRemark 设置用户备注名，备注名长度必须小于30个字符
+func (e *Engine) UpdateUserRemark(ctx context.Context, openId, remark string) error {
+	// https://api.weixin.qq.com/cgi-bin/user/info/updateremark?access_token=ACCESS_TOKEN
+	return postJSONCheck(ctx, e, "/cgi-bin/user/info/updateremark", &reqUpdateRemark{OpenId: openId, Remark: remark})
 }
@@ -0,0 +1,118 @@
+package weixin_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchGetUserInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req reqBatchGetUserInfo
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.LessOrEqual(t, len(req.UserList), MaxBatchGetUserInfo)
+		var resp respBatchGetUserInfo
+		for _, u := range req.UserList {
+			resp.UserInfoList = append(resp.UserInfoList, &UserInfo{Subscribe: 1, OpenId: u.OpenId, Language: u.Lang})
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	var openIds []string
+	for i := 0; i < 250; i++ {
+		openIds = append(openIds, fmt.Sprintf("openid_%d", i))
+	}
+	users, err := e.BatchGetUserInfo(context.Background(), openIds, LangZhCN, 2)
+	assert.Nil(t, err)
+	if assert.Len(t, users, 250) {
+		for i, u := range users {
+			assert.Equal(t, openIds[i], u.OpenId)
+		}
+	}
+}
+
+// lockingRepo 和repo.Memory一样，上锁失败时返回错误，可以并发使用
+type lockingRepo struct {
+	mu     sync.Mutex
+	tok    string
+	expire time.Time
+	locked int32
+}
+
+func (r *lockingRepo) GetAccessToken(_ context.Context) (string, time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.expire.Before(time.Now()) {
+		return "", r.expire, nil
+	}
+	return r.tok, r.expire, nil
+}
+
+func (r *lockingRepo) UpdateAccessToken(_ context.Context, tok string, expiredTime time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tok, r.expire = tok, expiredTime
+	return nil
+}
+
+func (r *lockingRepo) InvalidateAccessToken(_ context.Context, tok string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tok == tok {
+		r.tok, r.expire = "", time.Time{}
+	}
+	return nil
+}
+
+func (r *lockingRepo) Lock() error {
+	if atomic.CompareAndSwapInt32(&r.locked, 0, 1) {
+		return nil
+	}
+	return ErrRepoLocked
+}
+
+func (r *lockingRepo) UnLock() {
+	atomic.StoreInt32(&r.locked, 0)
+}
+
+func TestBatchGetUserInfoColdCache(t *testing.T) {
+	var grants int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cgi-bin/token" {
+			atomic.AddInt32(&grants, 1)
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{"access_token":"TOKEN","expires_in":7200}`))
+			return
+		}
+		assert.Equal(t, "TOKEN", r.URL.Query().Get("access_token"))
+		var req reqBatchGetUserInfo
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		var resp respBatchGetUserInfo
+		for _, u := range req.UserList {
+			resp.UserInfoList = append(resp.UserInfoList, &UserInfo{Subscribe: 1, OpenId: u.OpenId})
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &lockingRepo{}})
+	var openIds []string
+	for i := 0; i < 400; i++ {
+		openIds = append(openIds, fmt.Sprintf("openid_%d", i))
+	}
+	users, err := e.BatchGetUserInfo(context.Background(), openIds, LangZhCN, 4)
+	assert.Nil(t, err)
+	assert.Len(t, users, 400)
+	// 只有拿到锁的调用方获取token，其他调用方等待后从repository读取
+	assert.Equal(t, int32(1), atomic.LoadInt32(&grants))
+}
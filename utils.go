@@ -1,5 +1,11 @@
 package weixin_api
 
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
 // A simple stack
 type stack[T any] struct {
 	data []T
@@ -23,3 +29,52 @@ func (s *stack[T]) pop() T {
 func (s *stack[T]) peek() T {
 	return s.data[len(s.data)-1]
 }
+
+// 按每组最多n个拆分
+func chunk[T any](s []T, n int) [][]T {
+	var chunks [][]T
+	for len(s) > n {
+		chunks = append(chunks, s[:n])
+		s = s[n:]
+	}
+	if len(s) > 0 {
+		chunks = append(chunks, s)
+	}
+	return chunks
+}
+
+// 分批处理openid，某一批失败时继续处理剩下的批次，最后返回*BatchError。
+// ctx取消时不再处理剩下的批次，失败的和没有处理的openid都放在*BatchError中，Err包装ctx.Err()。
+func batchOpenIds(ctx context.Context, openIds []string, n int, fn func(ids []string) error) error {
+	var batchErr *BatchError
+	chunks := chunk(openIds, n)
+	for i, ids := range chunks {
+		if ctx.Err() != nil {
+			if batchErr == nil {
+				batchErr = &BatchError{}
+			}
+			for _, rest := range chunks[i:] {
+				batchErr.OpenIds = append(batchErr.OpenIds, rest...)
+			}
+			break
+		}
+		if err := fn(ids); err != nil {
+			if batchErr == nil {
+				batchErr = &BatchError{Err: err}
+			}
+			batchErr.OpenIds = append(batchErr.OpenIds, ids...)
+		}
+	}
+	if batchErr == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		switch {
+		case batchErr.Err == nil:
+			batchErr.Err = err
+		case !errors.Is(batchErr.Err, err):
+			batchErr.Err = errors.WithMessage(err, batchErr.Err.Error())
+		}
+	}
+	return batchErr
+}
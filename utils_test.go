@@ -0,0 +1,36 @@
+package weixin_api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchOpenIdsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var openIds []string
+	for i := 0; i < 45; i++ {
+		openIds = append(openIds, strconv.Itoa(i))
+	}
+	var calls int
+	err := batchOpenIds(ctx, openIds, 20, func(ids []string) error {
+		calls++
+		if calls == 1 {
+			return ErrInvalidOpenId
+		}
+		// 第二批成功后取消
+		cancel()
+		return nil
+	})
+	assert.Equal(t, 2, calls)
+	assert.ErrorIs(t, err, context.Canceled)
+	var batchErr *BatchError
+	if assert.True(t, errors.As(err, &batchErr)) {
+		// 第一批失败，第三批没有处理
+		assert.Equal(t, append(openIds[:20:20], openIds[40:]...), batchErr.OpenIds)
+		assert.Contains(t, batchErr.Error(), ErrInvalidOpenId.Error())
+	}
+}
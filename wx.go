@@ -2,17 +2,20 @@ package weixin_api
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
 type IEngine interface {
-	GetAccessToken() (string, error)
+	GetAccessToken(ctx context.Context) (string, error)
+	CreateQRCode(ctx context.Context, id int32, expireSeconds int32) (*QRCodeInfo, error)
+	CreateQRCodeByStr(ctx context.Context, id string, expireSeconds int32) (*QRCodeInfo, error)
+	CreateLimitQRCode(ctx context.Context, id int32) (*QRCodeInfo, error)
+	CreateLimitQRCodeByStr(ctx context.Context, id string) (*QRCodeInfo, error)
 }
 
 var _ IEngine = (*Engine)(nil)
@@ -23,22 +26,18 @@ type Engine struct {
 	appId     string
 	appSecret string
 	appToken  string
-	wxDomain  string
+	domains   []string // 第一个为主域名，其余为容灾时使用的备用域名
+	aesKey    []byte   // 安全模式下的消息加解密密钥
+	aesKeyErr error
+	// 回调消息体大小上限
+	maxBodySize int64
 	// accessToken            string
-	repo                   IRepository
-	client                 *http.Client
-	handleTextMessage      func(m *TextMessage) error
-	handleImageMessage     func(m *ImageMessage) error
-	handleVoiceMessage     func(m *VoiceMessage) error
-	handleVideoMessage     func(m *VideoMessage) error
-	handleLocationMessage  func(m *LocationMessage) error
-	handleLinkMessage      func(m *LinkMessage) error
-	handleClickEvent       func(m *ClickEvent) error
-	handleLocationEvent    func(m *LocationEvent) error
-	handleViewEvent        func(m *ViewEvent) error
-	handleScanEvent        func(m *ScanEvent) error
-	handleSubscribeEvent   func(m *SubscribeEvent) error
-	handleUnsubscribeEvent func(m *UnsubscribeEvent) error
+	repo   IRepository
+	client *http.Client
+	router *Router
+	// 推送消息去重
+	dedup    IDedupStore
+	dedupTTL time.Duration
 }
 
 type WeiXinApiConfig struct {
@@ -46,20 +45,54 @@ type WeiXinApiConfig struct {
 	AppSecret    string
 	AppToken     string
 	WeiXinDomain string
-	Repository   IRepository
+	// 开启容灾，主域名出现网络错误或5xx时切换到备用域名，POST请求只在连接失败时切换
+	EnableFailover bool
+	// 备用域名，为空时使用默认的BackupDomains
+	BackupDomains []string
+	// 消息加解密密钥，安全模式或兼容模式下需要设置
+	EncodingAESKey string
+	// ServeHTTP接收的消息体大小上限，默认为1MB
+	MaxBodySize int64
+	Repository  IRepository
+	// 调用微信API使用的http.Client，为空时使用Transport新建一个
+	HttpClient *http.Client
+	// HttpClient为空时使用的RoundTripper，为空时使用http.DefaultTransport
+	Transport http.RoundTripper
 	// AccessToken            string
-	HandleTextMessage      func(m *TextMessage) error
-	HandleImageMessage     func(m *ImageMessage) error
-	HandleVoiceMessage     func(m *VoiceMessage) error
-	HandleVideoMessage     func(m *VideoMessage) error
-	HandleLocationMessage  func(m *LocationMessage) error
-	HandleLinkMessage      func(m *LinkMessage) error
-	HandleClickEvent       func(m *ClickEvent) error
-	HandleLocationEvent    func(m *LocationEvent) error
-	HandleViewEvent        func(m *ViewEvent) error
-	HandleScanEvent        func(m *ScanEvent) error
-	HandleSubscribeEvent   func(m *SubscribeEvent) error
-	HandleUnsubscribeEvent func(m *UnsubscribeEvent) error
+	HandleTextMessage       func(m *TextMessage) (Reply, error)
+	HandleImageMessage      func(m *ImageMessage) (Reply, error)
+	HandleVoiceMessage      func(m *VoiceMessage) (Reply, error)
+	HandleVideoMessage      func(m *VideoMessage) (Reply, error)
+	HandleLocationMessage   func(m *LocationMessage) (Reply, error)
+	HandleLinkMessage       func(m *LinkMessage) (Reply, error)
+	HandleShortVideoMessage func(m *VideoMessage) (Reply, error)
+	HandleFileMessage       func(m *FileMessage) (Reply, error)
+	HandleClickEvent        func(m *ClickEvent) (Reply, error)
+	HandleLocationEvent     func(m *LocationEvent) (Reply, error)
+	HandleViewEvent         func(m *ViewEvent) (Reply, error)
+	HandleScanEvent         func(m *ScanEvent) (Reply, error)
+	HandleSubscribeEvent    func(m *SubscribeEvent) (Reply, error)
+	HandleUnsubscribeEvent  func(m *UnsubscribeEvent) (Reply, error)
+
+	HandleScanCodePushEvent       func(m *ScanCodeEvent) (Reply, error)
+	HandleScanCodeWaitMsgEvent    func(m *ScanCodeEvent) (Reply, error)
+	HandlePicSysPhotoEvent        func(m *PicEvent) (Reply, error)
+	HandlePicPhotoOrAlbumEvent    func(m *PicEvent) (Reply, error)
+	HandlePicWeixinEvent          func(m *PicEvent) (Reply, error)
+	HandleLocationSelectEvent     func(m *LocationSelectEvent) (Reply, error)
+	HandleViewMiniProgramEvent    func(m *ViewMiniProgramEvent) (Reply, error)
+	HandleArticleViewLimitedEvent func(m *ArticleViewLimitedEvent) (Reply, error)
+
+	HandleTemplateSendJobFinishEvent func(m *TemplateSendJobFinishEvent) (Reply, error)
+
+	// 没有对应处理函数的消息都交给HandleDefault处理
+	HandleDefault func(msgType, event string, data []byte) (Reply, error)
+	// 处理消息的中间件，先添加的在外层
+	Middlewares []Middleware
+	// 推送消息去重，为空时不去重
+	DedupStore IDedupStore
+	// 去重记录的保存时间，默认为DefaultDedupTTL
+	DedupTTL time.Duration
 }
 
 func New(cfg *WeiXinApiConfig) *Engine {
@@ -68,46 +101,94 @@ func New(cfg *WeiXinApiConfig) *Engine {
 	e.appToken = cfg.AppToken
 	e.appSecret = cfg.AppSecret
 	e.repo = cfg.Repository
+	e.maxBodySize = cfg.MaxBodySize
+	if e.maxBodySize <= 0 {
+		e.maxBodySize = defaultMaxBodySize
+	}
+	if cfg.EncodingAESKey != "" {
+		e.aesKey, e.aesKeyErr = DecodeAESKey(cfg.EncodingAESKey)
+	}
 
 	if cfg.WeiXinDomain == "" {
-		e.wxDomain = "https://api.weixin.qq.com"
+		e.domains = []string{"https://api.weixin.qq.com"}
 	} else {
-		e.wxDomain = "https://" + cfg.WeiXinDomain
+		e.domains = []string{domainToURL(cfg.WeiXinDomain)}
+	}
+	if cfg.EnableFailover {
+		backups := cfg.BackupDomains
+		if len(backups) == 0 {
+			backups = BackupDomains
+		}
+		for _, domain := range backups {
+			e.domains = append(e.domains, domainToURL(domain))
+		}
 	}
 
-	e.handleTextMessage = cfg.HandleTextMessage
-	e.handleImageMessage = cfg.HandleImageMessage
-	e.handleVoiceMessage = cfg.HandleVoiceMessage
-	e.handleVideoMessage = cfg.HandleVideoMessage
-	e.handleLocationMessage = cfg.HandleLocationMessage
-	e.handleLinkMessage = cfg.HandleLinkMessage
-	e.handleClickEvent = cfg.HandleClickEvent
-	e.handleLocationEvent = cfg.HandleLocationEvent
-	e.handleViewEvent = cfg.HandleViewEvent
-	e.handleScanEvent = cfg.HandleScanEvent
-	e.handleSubscribeEvent = cfg.HandleSubscribeEvent
-	e.handleUnsubscribeEvent = cfg.HandleUnsubscribeEvent
-	e.client = &http.Client{}
+	e.router = NewRouter()
+	e.RegTextMessageHandler(cfg.HandleTextMessage)
+	e.RegImageMessageHandler(cfg.HandleImageMessage)
+	e.RegVoiceMessageHandler(cfg.HandleVoiceMessage)
+	e.RegVideoMessageHandler(cfg.HandleVideoMessage)
+	e.RegLocationMessageHandler(cfg.HandleLocationMessage)
+	e.RegLinkMessageHandler(cfg.HandleLinkMessage)
+	e.RegShortVideoMessageHandler(cfg.HandleShortVideoMessage)
+	e.RegFileMessageHandler(cfg.HandleFileMessage)
+	e.RegClickEventHandler(cfg.HandleClickEvent)
+	e.RegLocationEventHandler(cfg.HandleLocationEvent)
+	e.RegViewEventHandler(cfg.HandleViewEvent)
+	e.RegScanEventHandler(cfg.HandleScanEvent)
+	e.RegSubscribeEventHandler(cfg.HandleSubscribeEvent)
+	e.RegUnsubscribeEventHandler(cfg.HandleUnsubscribeEvent)
+	e.RegScanCodePushEventHandler(cfg.HandleScanCodePushEvent)
+	e.RegScanCodeWaitMsgEventHandler(cfg.HandleScanCodeWaitMsgEvent)
+	e.RegPicSysPhotoEventHandler(cfg.HandlePicSysPhotoEvent)
+	e.RegPicPhotoOrAlbumEventHandler(cfg.HandlePicPhotoOrAlbumEvent)
+	e.RegPicWeixinEventHandler(cfg.HandlePicWeixinEvent)
+	e.RegLocationSelectEventHandler(cfg.HandleLocationSelectEvent)
+	e.RegViewMiniProgramEventHandler(cfg.HandleViewMiniProgramEvent)
+	e.RegArticleViewLimitedEventHandler(cfg.HandleArticleViewLimitedEvent)
+	e.RegTemplateSendJobFinishEventHandler(cfg.HandleTemplateSendJobFinishEvent)
+	e.RegDefaultHandler(cfg.HandleDefault)
+	e.router.Use(cfg.Middlewares...)
+	e.dedup = cfg.DedupStore
+	e.dedupTTL = cfg.DedupTTL
+	if e.dedupTTL <= 0 {
+		e.dedupTTL = DefaultDedupTTL
+	}
+	if cfg.HttpClient != nil {
+		e.client = cfg.HttpClient
+	} else {
+		e.client = &http.Client{Transport: cfg.Transport}
+	}
 	return e
 }
 
-func (e *Engine) GetAccessToken() (string, error) {
-	tok, expire, err := e.repo.GetAccessToken(context.Background())
+// HttpClient 返回调用微信接口使用的http.Client，可以传给HttpGet、PostJSON等函数
+func (e *Engine) HttpClient() *http.Client {
+	return e.client
+}
+
+func (e *Engine) GetAccessToken(ctx context.Context) (string, error) {
+	tok, expire, err := e.repo.GetAccessToken(ctx)
 	if err != nil {
 		return "", errors.WithMessage(err, "repo.GetAccessToken")
 	}
 	if tok == "" || time.Now().After(expire) {
 		// tok为空或tok已过期
-		if err = e.GrantAccessToken(); err != nil {
+		if err = e.GrantAccessToken(ctx); err != nil {
 			if tok != "" {
 				// 获取新的token失败，如果原来的tok不为空，先返回
 				return tok, nil
 			}
+			if errors.Is(err, ErrRepoLocked) {
+				// 其他调用方正在获取token，等它更新完repository
+				return e.waitAccessToken(ctx)
+			}
 			return "", errors.WithMessage(err, "GrantAccessToken")
 		}
 
 		// 再次获取access token
-		tok, _, err = e.repo.GetAccessToken(context.Background())
+		tok, _, err = e.repo.GetAccessToken(ctx)
 		if err != nil {
 			return "", errors.WithMessage(err, "repo.GetAccessToken")
 		}
@@ -116,6 +197,42 @@ func (e *Engine) GetAccessToken() (string, error) {
 	return tok, nil
 }
 
+// 等待其他调用方获取access token的轮询间隔和最长时间
+const (
+	tokenPollInterval = 100 * time.Millisecond
+	tokenWaitTimeout  = 10 * time.Second
+)
+
+// waitAccessToken 等待持有锁的调用方更新repository后重新读取token，
+// 持有锁的调用方获取失败并释放锁后，由当前调用方重新获取
+func (e *Engine) waitAccessToken(ctx context.Context) (string, error) {
+	deadline := time.Now().Add(tokenWaitTimeout)
+	for {
+		select {
+		case <-time.After(tokenPollInterval):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		tok, expire, err := e.repo.GetAccessToken(ctx)
+		if err != nil {
+			return "", errors.WithMessage(err, "repo.GetAccessToken")
+		}
+		if tok != "" && time.Now().Before(expire) {
+			return tok, nil
+		}
+		err = e.GrantAccessToken(ctx)
+		if err == nil {
+			if tok, _, err = e.repo.GetAccessToken(ctx); err != nil {
+				return "", errors.WithMessage(err, "repo.GetAccessToken")
+			}
+			return tok, nil
+		}
+		if !errors.Is(err, ErrRepoLocked) || time.Now().After(deadline) {
+			return "", errors.WithMessage(err, "GrantAccessToken")
+		}
+	}
+}
+
 type responseGrantToken struct {
 	ErrorMsg
 	AccessToken string `json:"access_token"`
@@ -123,39 +240,27 @@ type responseGrantToken struct {
 }
 
 // 从微信服务器获取Access Token，并保存到repository里面，后续调用GetAccessToken时，再从repository里面获取
-func (e *Engine) GrantAccessToken() error {
+func (e *Engine) GrantAccessToken(ctx context.Context) error {
 	if err := e.repo.Lock(); err != nil {
+		if errors.Is(err, ErrRepoLocked) {
+			return err
+		}
 		return errors.WithMessage(err, "repo.Lock")
 	}
 	defer e.repo.UnLock()
 	// https://api.weixin.qq.com/cgi-bin/token?grant_type=client_credential&appid=APPID&secret=APPSECRET
-	url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s", e.appId, e.appSecret)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return errors.Wrap(err, "http.NewRequest")
-	}
-
-	resp, err := e.client.Do(req)
+	path := fmt.Sprintf("/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s", e.appId, e.appSecret)
+	v, err := decodeJSON[responseGrantToken](e.doRequest(ctx, http.MethodGet, path, "", nil))
 	if err != nil {
-		return errors.Wrap(err, "DoRequest")
-	}
-
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return errors.Wrap(err, "ReadBody")
-	}
-
-	var v responseGrantToken
-	if err = json.Unmarshal(data, &v); err != nil {
-		return errors.Wrap(err, "UnmarshalBody")
+		return errors.WithMessage(err, "doRequest")
 	}
 
 	if v.ErrCode > 0 {
-		return errors.WithStack(&v)
+		return errors.WithStack(v)
 	}
 
 	// 提前60秒更新
-	if err = e.repo.UpdateAccessToken(context.Background(), v.AccessToken, time.Now().Add(time.Duration(v.ExpiresIn-60)*time.Second)); err != nil {
+	if err = e.repo.UpdateAccessToken(ctx, v.AccessToken, time.Now().Add(time.Duration(v.ExpiresIn-60)*time.Second)); err != nil {
 		return errors.Wrap(err, "repo.UpdateAccessToken")
 	}
 
@@ -184,27 +289,51 @@ type qrCodeReqBody[T any] struct {
 	ActionInfo    qrCodeActionInfo[T] `json:"action_info"`
 }
 
+func (e *Engine) CreateQRCode(ctx context.Context, id int32, expireSeconds int32) (*QRCodeInfo, error) {
+	return createQRCode(ctx, e, "QR_SCENE", "scene_id", id, expireSeconds)
+}
+
+func (e *Engine) CreateQRCodeByStr(ctx context.Context, id string, expireSeconds int32) (*QRCodeInfo, error) {
+	return createQRCode(ctx, e, "QR_STR_SCENE", "scene_str", id, expireSeconds)
+}
+
+func (e *Engine) CreateLimitQRCode(ctx context.Context, id int32) (*QRCodeInfo, error) {
+	return createQRCode(ctx, e, "QR_LIMIT_SCENE", "scene_id", id, 0)
+}
+
+func (e *Engine) CreateLimitQRCodeByStr(ctx context.Context, id string) (*QRCodeInfo, error) {
+	return createQRCode(ctx, e, "QR_LIMIT_STR_SCENE", "scene_str", id, 0)
+}
+
+// CreateQRCode 创建临时二维码
+//
+// Deprecated: 使用Engine.CreateQRCode，可以传入context
 func CreateQRCode(e IEngine, id int32, expireSeconds int32) (*QRCodeInfo, error) {
-	return createQRCode(e, "QR_SCENE", "scene_id", id, expireSeconds)
+	return e.CreateQRCode(context.Background(), id, expireSeconds)
 }
 
+// CreateQRCodeByStr 创建字符串场景值的临时二维码
+//
+// Deprecated: 使用Engine.CreateQRCodeByStr，可以传入context
 func CreateQRCodeByStr(e IEngine, id string, expireSeconds int32) (*QRCodeInfo, error) {
-	return createQRCode(e, "QR_STR_SCENE", "scene_str", id, expireSeconds)
+	return e.CreateQRCodeByStr(context.Background(), id, expireSeconds)
 }
 
+// CreateLimitQRCode 创建永久二维码
+//
+// Deprecated: 使用Engine.CreateLimitQRCode，可以传入context
 func CreateLimitQRCode(e IEngine, id int32) (*QRCodeInfo, error) {
-	return createQRCode(e, "QR_LIMIT_SCENE", "scene_id", id, 0)
+	return e.CreateLimitQRCode(context.Background(), id)
 }
 
+// CreateLimitQRCodeByStr 创建字符串场景值的永久二维码
+//
+// Deprecated: 使用Engine.CreateLimitQRCodeByStr，可以传入context
 func CreateLimitQRCodeByStr(e IEngine, id string) (*QRCodeInfo, error) {
-	return createQRCode(e, "QR_LIMIT_STR_SCENE", "scene_str", id, 0)
+	return e.CreateLimitQRCodeByStr(context.Background(), id)
 }
 
-func createQRCode[IdType any](e IEngine, actionName, idKey string, id IdType, expireSeconds int32) (*QRCodeInfo, error) {
-	tok, err := e.GetAccessToken()
-	if err != nil {
-		return nil, errors.WithMessage(err, "GetAccessToken:")
-	}
+func createQRCode[IdType any](ctx context.Context, e *Engine, actionName, idKey string, id IdType, expireSeconds int32) (*QRCodeInfo, error) {
 	req := qrCodeReqBody[IdType]{
 		ExpireSeconds: expireSeconds,
 		ActionName:    actionName,
@@ -215,9 +344,9 @@ func createQRCode[IdType any](e IEngine, actionName, idKey string, id IdType, ex
 		},
 	}
 
-	info, err := PostJSON[QRCodeInfo](`https://api.weixin.qq.com/cgi-bin/qrcode/create?access_token=`+tok, &req)
+	info, err := postJSON[QRCodeInfo](ctx, e, "/cgi-bin/qrcode/create", &req)
 	if err != nil {
-		return nil, errors.WithMessage(err, "PostJSON:")
+		return nil, errors.WithMessage(err, "postJSON:")
 	}
 
 	if info.ErrCode > 0 {
@@ -234,13 +363,13 @@ type SessionInfo struct {
 	UnionId    string `json:"unionid"`
 }
 
-func (e *Engine) Code2Session(jscode string) (*SessionInfo, error) {
+func (e *Engine) Code2Session(ctx context.Context, jscode string) (*SessionInfo, error) {
 	// url: https://api.weixin.qq.com/sns/jscode2session?appid=APPID&secret=SECRET&js_code=JSCODE&grant_type=authorization_code
 
-	url := fmt.Sprintf("https://api.weixin.qq.com/sns/jscode2session?appid=%s&secret=%s&js_code=%s&grant_type=authorization_code", e.appId, e.appSecret, jscode)
-	info, err := HttpGet[SessionInfo](url)
+	path := fmt.Sprintf("/sns/jscode2session?appid=%s&secret=%s&js_code=%s&grant_type=authorization_code", e.appId, e.appSecret, url.QueryEscape(jscode))
+	info, err := decodeJSON[SessionInfo](e.doRequest(ctx, http.MethodGet, path, "", nil))
 	if err != nil {
-		return nil, errors.WithMessage(err, "PostJSON:")
+		return nil, errors.WithMessage(err, "doRequest:")
 	}
 
 	if info.ErrCode > 0 {
@@ -266,20 +395,15 @@ type respPhoneNumber struct {
 	PhoneInfo *PhoneInfo `json:"phone_info"`
 }
 
-func (e *Engine) GetPhoneNumber(code string) (*PhoneInfo, error) {
+func (e *Engine) GetPhoneNumber(ctx context.Context, code string) (*PhoneInfo, error) {
 	// url: https://api.weixin.qq.com/wxa/business/getuserphonenumber?access_token=ACCESS_TOKEN
-	tok, err := e.GetAccessToken()
-	if err != nil {
-		return nil, errors.WithMessage(err, "GetAccessToken:")
-	}
 	req := reqPhoneNumberBody{
 		Code: code,
 	}
 
-	url := fmt.Sprintf("https://api.weixin.qq.com/wxa/business/getuserphonenumber?access_token=%s", tok)
-	info, err := PostJSON[respPhoneNumber](url, &req)
+	info, err := postJSON[respPhoneNumber](ctx, e, "/wxa/business/getuserphonenumber", &req)
 	if err != nil {
-		return nil, errors.WithMessage(err, "PostJSON:")
+		return nil, errors.WithMessage(err, "postJSON:")
 	}
 
 	if info.ErrCode > 0 {
@@ -0,0 +1,288 @@
+package weixin_api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试用的repository
+type testRepo struct {
+	tok    string
+	expire time.Time
+}
+
+func (r *testRepo) GetAccessToken(_ context.Context) (string, time.Time, error) {
+	return r.tok, r.expire, nil
+}
+
+func (r *testRepo) UpdateAccessToken(_ context.Context, tok string, expiredTime time.Time) error {
+	r.tok = tok
+	r.expire = expiredTime
+	return nil
+}
+
+func (r *testRepo) InvalidateAccessToken(_ context.Context, tok string) error {
+	if r.tok == tok {
+		r.tok = ""
+		r.expire = time.Time{}
+	}
+	return nil
+}
+
+func (r *testRepo) Lock() error { return nil }
+
+func (r *testRepo) UnLock() {}
+
+func TestDomainFailover(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	var paths []string
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"access_token":"TOKEN","expires_in":7200}`))
+	}))
+	defer backup.Close()
+
+	repo := &testRepo{}
+	e := New(&WeiXinApiConfig{
+		AppId:          "wx123",
+		WeiXinDomain:   primary.URL,
+		EnableFailover: true,
+		BackupDomains:  []string{backup.URL},
+		Repository:     repo,
+	})
+	assert.Nil(t, e.GrantAccessToken(context.Background()))
+	assert.Equal(t, "TOKEN", repo.tok)
+	assert.Equal(t, []string{"/cgi-bin/token"}, paths)
+
+	// 未开启容灾时不切换域名
+	e = New(&WeiXinApiConfig{WeiXinDomain: primary.URL, Repository: repo})
+	assert.NotNil(t, e.GrantAccessToken(context.Background()))
+}
+
+func TestRetryOnTokenInvalid(t *testing.T) {
+	var grants, calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cgi-bin/token":
+			grants++
+			w.Write([]byte(`{"access_token":"NEW","expires_in":7200}`))
+		case "/cgi-bin/menu/create":
+			calls++
+			if r.URL.Query().Get("access_token") != "NEW" {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+				return
+			}
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+	defer srv.Close()
+
+	repo := &testRepo{tok: "OLD", expire: time.Now().Add(time.Hour)}
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: repo})
+	err := e.CreateMenu(context.Background(), &Menu{Button: []*Button{ClickButton("今日歌曲", "V1001_TODAY_MUSIC")}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, grants)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "NEW", repo.tok)
+}
+
+func TestConcurrentTokenRotation(t *testing.T) {
+	var grants int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cgi-bin/token":
+			atomic.AddInt32(&grants, 1)
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{"access_token":"NEW","expires_in":7200}`))
+		case "/cgi-bin/menu/delete":
+			if r.URL.Query().Get("access_token") != "NEW" {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+				return
+			}
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+	defer srv.Close()
+
+	repo := &lockingRepo{tok: "OLD", expire: time.Now().Add(time.Hour)}
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: repo})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, e.DeleteMenu(context.Background()))
+		}()
+	}
+	wg.Wait()
+	// 只有一个调用方重新获取token，其他调用方等待后使用新的token重试
+	assert.Equal(t, int32(1), atomic.LoadInt32(&grants))
+}
+
+func TestRequestCanceled(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{
+		WeiXinDomain:   srv.URL,
+		EnableFailover: true,
+		BackupDomains:  []string{srv.URL},
+		Repository:     &testRepo{},
+		HttpClient:     srv.Client(),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(t, e.GrantAccessToken(ctx))
+	assert.Equal(t, 0, hits)
+}
+
+func TestFailoverLogRedacted(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = logger }()
+
+	// 两个域名都无法连接
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+	e := New(&WeiXinApiConfig{
+		AppId:          "wx123",
+		AppSecret:      "TOP_SECRET",
+		WeiXinDomain:   srv.URL,
+		EnableFailover: true,
+		BackupDomains:  []string{srv.URL},
+		Repository:     &testRepo{},
+	})
+	err := e.GrantAccessToken(context.Background())
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "TOP_SECRET")
+	assert.Contains(t, buf.String(), "/cgi-bin/token")
+	assert.NotContains(t, buf.String(), "TOP_SECRET")
+
+	assert.Equal(t, "/sns/jscode2session?appid=wx&js_code=REDACTED&secret=REDACTED",
+		redactURL("/sns/jscode2session?appid=wx&secret=s&js_code=c"))
+	assert.Equal(t, "/cgi-bin/menu/get", redactURL("/cgi-bin/menu/get"))
+}
+
+func TestCreateQRCode(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cgi-bin/qrcode/create", r.URL.Path)
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		w.Write([]byte(`{"ticket":"TICKET","expire_seconds":60,"url":"http://weixin.qq.com/q/kZgfwMTm72WWPkovabbI"}`))
+	}))
+	defer srv.Close()
+
+	e := New(&WeiXinApiConfig{WeiXinDomain: srv.URL, Repository: &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)}})
+	info, err := CreateQRCode(e, 123, 60)
+	assert.Nil(t, err)
+	assert.Equal(t, "TICKET", info.Ticket)
+	_, err = CreateLimitQRCodeByStr(e, "scene")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"expire_seconds":60,"action_name":"QR_SCENE","action_info":{"scene":{"scene_id":123}}}`, bodies[0])
+	assert.JSONEq(t, `{"action_name":"QR_LIMIT_STR_SCENE","action_info":{"scene":{"scene_str":"scene"}}}`, bodies[1])
+}
+
+type countingTransport struct {
+	calls int
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.calls++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHttpHelpersUseClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	e := New(&WeiXinApiConfig{Transport: transport, Repository: &testRepo{}})
+	msg, err := HttpGet[ErrorMsg](context.Background(), e.HttpClient(), srv.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", msg.ErrMsg)
+	_, err = PostJSON[ErrorMsg](context.Background(), e.HttpClient(), srv.URL, map[string]string{"a": "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, transport.calls)
+}
+
+// brokenLockRepo 上锁时连接repository失败
+type brokenLockRepo struct {
+	testRepo
+}
+
+func (r *brokenLockRepo) Lock() error {
+	return errors.New("dial tcp: connection refused")
+}
+
+func TestGetAccessTokenLockError(t *testing.T) {
+	e := New(&WeiXinApiConfig{Repository: &brokenLockRepo{}})
+	start := time.Now()
+	_, err := e.GetAccessToken(context.Background())
+	// 不是锁冲突，直接返回错误，不等待其他调用方
+	assert.ErrorContains(t, err, "connection refused")
+	assert.NotErrorIs(t, err, ErrRepoLocked)
+	assert.Less(t, time.Since(start), tokenPollInterval)
+}
+
+func TestFailoverPostNotRepeated(t *testing.T) {
+	var primaryHits, backupHits int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 服务器收到了请求，但回包超时
+		atomic.AddInt32(&primaryHits, 1)
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupHits, 1)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer backup.Close()
+
+	e := New(&WeiXinApiConfig{
+		WeiXinDomain:   primary.URL,
+		EnableFailover: true,
+		BackupDomains:  []string{backup.URL},
+		Repository:     &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)},
+		HttpClient:     &http.Client{Timeout: 100 * time.Millisecond},
+	})
+	err := e.SendKfMessage(context.Background(), NewKfTextMessage("OPENID", "hello"))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primaryHits))
+	// POST请求可能已经被处理，不能发到备用域名
+	assert.Equal(t, int32(0), atomic.LoadInt32(&backupHits))
+
+	// 连接失败时请求没有发送出去，可以切换域名
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+	e = New(&WeiXinApiConfig{
+		WeiXinDomain:   closed.URL,
+		EnableFailover: true,
+		BackupDomains:  []string{backup.URL},
+		Repository:     &testRepo{tok: "TOKEN", expire: time.Now().Add(time.Hour)},
+	})
+	assert.Nil(t, e.SendKfMessage(context.Background(), NewKfTextMessage("OPENID", "hello")))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&backupHits))
+}